@@ -0,0 +1,202 @@
+package backoff
+
+import (
+	"context"
+	"errors"
+	"math"
+	"math/rand"
+	"time"
+)
+
+const (
+	// DefaultBase is the delay after the first failed attempt when Options.Base is not set
+	DefaultBase = time.Second
+
+	// DefaultFactor is the multiplier of consecutive delays when Options.Factor is not set
+	DefaultFactor = 2
+
+	// DefaultMaxDelay is the maximum delay when Options.MaxDelay is not set
+	DefaultMaxDelay = time.Minute
+)
+
+// ErrMaxAttempts is returned when the maximum number of attempts is reached
+var ErrMaxAttempts = errors.New("maximum number of attempts reached")
+
+// Jitter describes how delays are randomized, so clients failing together don't retry in lockstep
+type Jitter int
+
+const (
+	// NoJitter uses the exact exponential delay
+	NoJitter Jitter = iota
+
+	// FullJitter picks a random delay between zero and the exponential delay
+	FullJitter
+
+	// EqualJitter keeps half of the exponential delay and randomizes the other half
+	EqualJitter
+)
+
+// Clock waits for durations to pass.
+// It's a seam for tests, which can advance time deterministically.
+type Clock interface {
+	After(time.Duration) <-chan time.Time
+}
+
+// systemClock is a Clock using the time package
+type systemClock struct{}
+
+func (systemClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+// Options holds options for a backoff
+type Options struct {
+	// Base is the delay after the first failed attempt, DefaultBase is used when it's 0
+	Base time.Duration
+
+	// Factor multiplies the delay after each failed attempt, DefaultFactor is used when it's 0
+	Factor float64
+
+	// MaxDelay caps the delay before jitter is applied, DefaultMaxDelay is used when it's 0
+	MaxDelay time.Duration
+
+	// Jitter randomizes delays, they're not randomized by default
+	Jitter Jitter
+
+	// MaxAttempts is the maximum number of failed attempts, there's no limit when it's 0
+	MaxAttempts int
+
+	// Clock is used to wait for delays, the system clock is used when it's nil
+	Clock Clock
+
+	// Rand is the source of jitter, the default source of the math/rand package is used when it's nil
+	Rand *rand.Rand
+}
+
+// Backoff implements a bounded exponential backoff algorithm with optional jitter.
+// The zero value of Backoff uses default options. It's not safe for concurrent use.
+type Backoff struct {
+	options  Options
+	attempts int
+}
+
+// New creates a backoff
+func New(options Options) *Backoff {
+	return &Backoff{options: options}
+}
+
+// Attempt records a failed attempt
+func (b *Backoff) Attempt() {
+	b.attempts++
+}
+
+// Reset resets the number of attempts
+func (b *Backoff) Reset() {
+	b.attempts = 0
+}
+
+// Attempts returns the number of failed attempts
+func (b *Backoff) Attempts() int {
+	return b.attempts
+}
+
+// Exhausted checks if the maximum number of attempts is reached
+func (b *Backoff) Exhausted() bool {
+	return b.options.MaxAttempts > 0 && b.attempts >= b.options.MaxAttempts
+}
+
+// Delay calculates the time to wait before the next attempt. It's zero when no attempt failed yet.
+func (b *Backoff) Delay() time.Duration {
+	if b.attempts == 0 {
+		return 0
+	}
+
+	base := b.options.Base
+	if base <= 0 {
+		base = DefaultBase
+	}
+
+	factor := b.options.Factor
+	if factor <= 0 {
+		factor = DefaultFactor
+	}
+
+	maxDelay := b.options.MaxDelay
+	if maxDelay <= 0 {
+		maxDelay = DefaultMaxDelay
+	}
+
+	// Compute in floating point, so large numbers of attempts don't overflow
+	delay := float64(base) * math.Pow(factor, float64(b.attempts-1))
+	if delay > float64(maxDelay) {
+		delay = float64(maxDelay)
+	}
+
+	switch b.options.Jitter {
+	case FullJitter:
+		delay *= b.random()
+	case EqualJitter:
+		delay = delay/2 + delay/2*b.random()
+	}
+
+	return time.Duration(delay)
+}
+
+// Sleep waits for the duration on the backoff's clock.
+// It returns the context error if the context is done first.
+func (b *Backoff) Sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+
+	select {
+	case <-b.clock().After(d):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Wait waits for the delay before the next attempt.
+// It returns ErrMaxAttempts if the maximum number of attempts is reached.
+func (b *Backoff) Wait(ctx context.Context) error {
+	if b.Exhausted() {
+		return ErrMaxAttempts
+	}
+	return b.Sleep(ctx, b.Delay())
+}
+
+// Retry calls fn until it succeeds, the maximum number of attempts is reached or the context is done.
+// It waits for the backoff delay between attempts.
+// It returns the last error of fn, or the context error when the context is done while waiting.
+func Retry(ctx context.Context, b *Backoff, fn func() error) error {
+	for {
+		if err := b.Wait(ctx); err != nil {
+			return err
+		}
+
+		err := fn()
+		if err == nil {
+			b.Reset()
+			return nil
+		}
+
+		b.Attempt()
+
+		if b.Exhausted() {
+			return err
+		}
+	}
+}
+
+func (b *Backoff) clock() Clock {
+	if b.options.Clock != nil {
+		return b.options.Clock
+	}
+	return systemClock{}
+}
+
+func (b *Backoff) random() float64 {
+	if b.options.Rand != nil {
+		return b.options.Rand.Float64()
+	}
+	return rand.Float64()
+}
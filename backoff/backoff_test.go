@@ -0,0 +1,143 @@
+package backoff_test
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/figment-networks/indexing-engine/backoff"
+)
+
+// fakeClock records the durations waited for and lets them pass right away
+type fakeClock struct {
+	waited []time.Duration
+}
+
+func (c *fakeClock) After(d time.Duration) <-chan time.Time {
+	c.waited = append(c.waited, d)
+
+	ch := make(chan time.Time, 1)
+	ch <- time.Time{}
+	return ch
+}
+
+// delays returns the delays after each of the given number of failed attempts
+func delays(b *backoff.Backoff, attempts int) []time.Duration {
+	var delays []time.Duration
+	for i := 0; i < attempts; i++ {
+		b.Attempt()
+		delays = append(delays, b.Delay())
+	}
+	return delays
+}
+
+func TestBackoff_Delay(t *testing.T) {
+	t.Run("zero value uses defaults", func(t *testing.T) {
+		var b backoff.Backoff
+		require.Equal(t, time.Duration(0), b.Delay())
+
+		d := delays(&b, 8)
+		require.Equal(t, []time.Duration{
+			time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second,
+			16 * time.Second, 32 * time.Second, time.Minute, time.Minute,
+		}, d)
+
+		b.Reset()
+		require.Equal(t, time.Duration(0), b.Delay())
+	})
+
+	t.Run("custom base, factor and max delay", func(t *testing.T) {
+		b := backoff.New(backoff.Options{Base: 100 * time.Millisecond, Factor: 3, MaxDelay: 2 * time.Second})
+
+		require.Equal(t, []time.Duration{
+			100 * time.Millisecond, 300 * time.Millisecond, 900 * time.Millisecond, 2 * time.Second,
+		}, delays(b, 4))
+	})
+
+	t.Run("large number of attempts stays capped", func(t *testing.T) {
+		var b backoff.Backoff
+		for i := 0; i < 10000; i++ {
+			b.Attempt()
+		}
+		require.Equal(t, backoff.DefaultMaxDelay, b.Delay())
+	})
+
+	t.Run("jitter stays within bounds", func(t *testing.T) {
+		full := backoff.New(backoff.Options{Jitter: backoff.FullJitter, Rand: rand.New(rand.NewSource(1))})
+		equal := backoff.New(backoff.Options{Jitter: backoff.EqualJitter, Rand: rand.New(rand.NewSource(1))})
+
+		for i := 0; i < 3; i++ {
+			full.Attempt()
+			equal.Attempt()
+		}
+
+		for i := 0; i < 100; i++ {
+			require.True(t, full.Delay() <= 4*time.Second)
+
+			d := equal.Delay()
+			require.True(t, d >= 2*time.Second && d <= 4*time.Second, d)
+		}
+	})
+}
+
+func TestBackoff_Wait(t *testing.T) {
+	t.Run("waits on the clock until max attempts", func(t *testing.T) {
+		clock := &fakeClock{}
+		b := backoff.New(backoff.Options{MaxAttempts: 2, Clock: clock})
+
+		require.NoError(t, b.Wait(context.Background()))
+		b.Attempt()
+		require.NoError(t, b.Wait(context.Background()))
+		b.Attempt()
+		require.True(t, b.Exhausted())
+		require.Equal(t, backoff.ErrMaxAttempts, b.Wait(context.Background()))
+
+		require.Equal(t, []time.Duration{time.Second}, clock.waited)
+	})
+
+	t.Run("sleep returns when context is done", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		var b backoff.Backoff
+		require.Equal(t, context.Canceled, b.Sleep(ctx, time.Hour))
+	})
+}
+
+func TestRetry(t *testing.T) {
+	t.Run("retries until success", func(t *testing.T) {
+		clock := &fakeClock{}
+		b := backoff.New(backoff.Options{Clock: clock})
+
+		var calls int
+		err := backoff.Retry(context.Background(), b, func() error {
+			calls++
+			if calls < 3 {
+				return errors.New("unavailable")
+			}
+			return nil
+		})
+
+		require.NoError(t, err)
+		require.Equal(t, 3, calls)
+		require.Equal(t, []time.Duration{time.Second, 2 * time.Second}, clock.waited)
+		require.Equal(t, 0, b.Attempts())
+	})
+
+	t.Run("returns last error after max attempts", func(t *testing.T) {
+		b := backoff.New(backoff.Options{MaxAttempts: 3, Clock: &fakeClock{}})
+
+		var calls int
+		err := backoff.Retry(context.Background(), b, func() error {
+			calls++
+			return errors.New("unavailable")
+		})
+
+		require.EqualError(t, err, "unavailable")
+		require.Equal(t, 3, calls)
+	})
+}
@@ -0,0 +1,82 @@
+package pipeline
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// adminOptions represents the request body of the options endpoint.
+// Fields that are not set are left unchanged.
+type adminOptions struct {
+	StagesBlacklist *[]StageName `json:"stages_blacklist"`
+	TaskWhitelist   *[]TaskName  `json:"task_whitelist"`
+}
+
+// NewAdminHandler creates an http handler that lets an operator inspect and control a running pipeline.
+//
+// Available endpoints:
+//
+//	GET  /status  - returns the pipeline status
+//	POST /pause   - pauses the pipeline before the next height
+//	POST /resume  - resumes a paused pipeline
+//	PUT  /options - replaces the stages blacklist and/or task whitelist starting with the next height
+//
+// The handler can be mounted under a prefix using http.StripPrefix.
+func NewAdminHandler(p Pipeline) http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/status", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		writeAdminStatus(w, p)
+	})
+
+	mux.HandleFunc("/pause", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		p.Pause()
+		writeAdminStatus(w, p)
+	})
+
+	mux.HandleFunc("/resume", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		p.Resume()
+		writeAdminStatus(w, p)
+	})
+
+	mux.HandleFunc("/options", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPut {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		var opts adminOptions
+		if err := json.NewDecoder(r.Body).Decode(&opts); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if opts.StagesBlacklist != nil {
+			p.SetStagesBlacklist(*opts.StagesBlacklist)
+		}
+		if opts.TaskWhitelist != nil {
+			p.SetTaskWhitelist(*opts.TaskWhitelist)
+		}
+
+		w.WriteHeader(http.StatusAccepted)
+	})
+
+	return mux
+}
+
+func writeAdminStatus(w http.ResponseWriter, p Pipeline) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(p.Status())
+}
@@ -0,0 +1,171 @@
+package pipeline_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+
+	"github.com/figment-networks/indexing-engine/pipeline"
+	"github.com/figment-networks/indexing-engine/pipeline/mock"
+)
+
+func TestAdminHandler(t *testing.T) {
+	t.Run("pauses, reconfigures and resumes running pipeline", func(t *testing.T) {
+		ctrl, ctx := gomock.WithContext(context.Background(), t)
+		defer ctrl.Finish()
+
+		payloadFactoryMock := mock.NewMockPayloadFactory(ctrl)
+		payloadFactoryMock.EXPECT().GetPayload(gomock.Any()).Return(&payloadMock{}).Times(2)
+
+		p := pipeline.NewCustom(payloadFactoryMock)
+
+		fetcherTask := mock.NewMockTask(ctrl)
+		fetcherTask.EXPECT().GetName().Times(0)
+		fetcherTask.EXPECT().Run(gomock.Any(), gomock.Any()).Times(0)
+		p.AddStage(pipeline.NewStageWithTasks(pipeline.StageFetcher, fetcherTask))
+
+		parserTask := mock.NewMockTask(ctrl)
+		parserTask.EXPECT().GetName().Return("parserTask").Times(4)
+		parserTask.EXPECT().Run(gomock.Any(), gomock.Any()).Return(nil).Times(2)
+		p.AddStage(pipeline.NewStageWithTasks(pipeline.StageParser, parserTask))
+
+		sinkMock := mock.NewMockSink(ctrl)
+		sinkMock.EXPECT().Consume(gomock.Any(), gomock.Any()).Return(nil).Times(2)
+
+		srv := httptest.NewServer(pipeline.NewAdminHandler(p))
+		defer srv.Close()
+
+		res := doAdminRequest(t, http.MethodPost, srv.URL+"/pause", "")
+		if res.StatusCode != http.StatusOK {
+			t.Fatalf("exp: %d, got: %d", http.StatusOK, res.StatusCode)
+		}
+
+		done := make(chan error)
+		go func() {
+			done <- p.Start(ctx, &sourceMock{1, 2, 1, false}, sinkMock, nil)
+		}()
+
+		waitForStatus(t, p, func(s pipeline.Status) bool { return s.Running })
+
+		res = doAdminRequest(t, http.MethodPut, srv.URL+"/options", `{"stages_blacklist": ["stage_fetcher"]}`)
+		if res.StatusCode != http.StatusAccepted {
+			t.Fatalf("exp: %d, got: %d", http.StatusAccepted, res.StatusCode)
+		}
+
+		if s := p.Status(); !s.Paused || s.HeightsCompleted != 0 {
+			t.Fatalf("expected pipeline to be paused before first height, got: %+v", s)
+		}
+
+		res = doAdminRequest(t, http.MethodPost, srv.URL+"/resume", "")
+		if res.StatusCode != http.StatusOK {
+			t.Fatalf("exp: %d, got: %d", http.StatusOK, res.StatusCode)
+		}
+
+		if err := <-done; err != nil {
+			t.Fatalf("did not expect error, got: %v", err)
+		}
+
+		res = doAdminRequest(t, http.MethodGet, srv.URL+"/status", "")
+
+		var status pipeline.Status
+		if err := json.NewDecoder(res.Body).Decode(&status); err != nil {
+			t.Fatalf("cannot decode status: %v", err)
+		}
+
+		if status.Running || status.Paused {
+			t.Errorf("expected pipeline to be stopped, got: %+v", status)
+		}
+		if status.CurrentHeight != 2 || status.HeightsCompleted != 2 || status.HeightsFailed != 0 {
+			t.Errorf("unexpected status: %+v", status)
+		}
+		if len(status.StagesBlacklist) != 1 || status.StagesBlacklist[0] != pipeline.StageFetcher {
+			t.Errorf("unexpected stages blacklist: %v", status.StagesBlacklist)
+		}
+		if status.LastHeightStat == nil || !status.LastHeightStat.Success {
+			t.Errorf("expected successful last height stat, got: %+v", status.LastHeightStat)
+		}
+	})
+
+	t.Run("status contains last error", func(t *testing.T) {
+		ctrl, ctx := gomock.WithContext(context.Background(), t)
+		defer ctrl.Finish()
+
+		payloadFactoryMock := mock.NewMockPayloadFactory(ctrl)
+		payloadFactoryMock.EXPECT().GetPayload(gomock.Any()).Return(&payloadMock{}).Times(1)
+
+		p := pipeline.NewCustom(payloadFactoryMock)
+
+		task := mock.NewMockTask(ctrl)
+		task.EXPECT().GetName().Return("task").Times(2)
+		task.EXPECT().Run(gomock.Any(), gomock.Any()).Return(errors.New("test err")).Times(1)
+		p.AddStage(pipeline.NewStageWithTasks(pipeline.StageFetcher, task))
+
+		if _, err := p.Run(ctx, 10, nil); err == nil {
+			t.Fatalf("expected error")
+		}
+
+		srv := httptest.NewServer(pipeline.NewAdminHandler(p))
+		defer srv.Close()
+
+		res := doAdminRequest(t, http.MethodGet, srv.URL+"/status", "")
+
+		var status pipeline.Status
+		if err := json.NewDecoder(res.Body).Decode(&status); err != nil {
+			t.Fatalf("cannot decode status: %v", err)
+		}
+
+		if status.LastError != "test err" || status.LastErrorHeight != 10 || status.HeightsFailed != 1 {
+			t.Errorf("unexpected status: %+v", status)
+		}
+	})
+
+	t.Run("rejects invalid requests", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		p := pipeline.NewCustom(mock.NewMockPayloadFactory(ctrl))
+
+		srv := httptest.NewServer(pipeline.NewAdminHandler(p))
+		defer srv.Close()
+
+		if res := doAdminRequest(t, http.MethodGet, srv.URL+"/pause", ""); res.StatusCode != http.StatusMethodNotAllowed {
+			t.Errorf("exp: %d, got: %d", http.StatusMethodNotAllowed, res.StatusCode)
+		}
+
+		if res := doAdminRequest(t, http.MethodPut, srv.URL+"/options", "{"); res.StatusCode != http.StatusBadRequest {
+			t.Errorf("exp: %d, got: %d", http.StatusBadRequest, res.StatusCode)
+		}
+	})
+}
+
+func doAdminRequest(t *testing.T, method, url, body string) *http.Response {
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("cannot create request: %v", err)
+	}
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	t.Cleanup(func() { res.Body.Close() })
+
+	return res
+}
+
+func waitForStatus(t *testing.T, p pipeline.Pipeline, cond func(pipeline.Status) bool) {
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond(p.Status()) {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for pipeline status, got: %+v", p.Status())
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
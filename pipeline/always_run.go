@@ -0,0 +1,36 @@
+package pipeline
+
+import (
+	"context"
+	"time"
+)
+
+// ctxFailureCause is the context key under which the failure cause is stored for always-run stages
+const ctxFailureCause = ctxKey("failure_cause")
+
+// FailureCause returns the error which caused the height to fail.
+// It is available to always-run stages executed after an earlier stage failed and returns nil otherwise.
+func FailureCause(ctx context.Context) error {
+	err, _ := ctx.Value(ctxFailureCause).(error)
+	return err
+}
+
+// withFailureCause returns a context for always-run stages.
+// The context keeps the values of the parent but is never cancelled, so the stages can clean up
+// even when the failure was caused by cancellation.
+func withFailureCause(ctx context.Context, cause error) context.Context {
+	return context.WithValue(detachedContext{parent: ctx}, ctxFailureCause, cause)
+}
+
+// detachedContext exposes the values of its parent without its deadline and cancellation
+type detachedContext struct {
+	parent context.Context
+}
+
+func (detachedContext) Deadline() (time.Time, bool) { return time.Time{}, false }
+func (detachedContext) Done() <-chan struct{}       { return nil }
+func (detachedContext) Err() error                  { return nil }
+
+func (c detachedContext) Value(key interface{}) interface{} {
+	return c.parent.Value(key)
+}
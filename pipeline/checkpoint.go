@@ -0,0 +1,182 @@
+package pipeline
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/figment-networks/indexing-engine/datalake"
+)
+
+// PayloadCodec is implemented by types that know how to serialize payloads for checkpoints
+type PayloadCodec interface {
+	// Encode serializes the payload
+	Encode(Payload) ([]byte, error)
+
+	// Decode restores the serialized data into a payload created by the payload factory
+	Decode([]byte, Payload) error
+}
+
+// JSONPayloadCodec serializes payloads as JSON
+type JSONPayloadCodec struct{}
+
+// Encode serializes the payload as JSON
+func (JSONPayloadCodec) Encode(p Payload) ([]byte, error) {
+	return json.Marshal(p)
+}
+
+// Decode restores the payload from JSON
+func (JSONPayloadCodec) Decode(data []byte, p Payload) error {
+	return json.Unmarshal(data, p)
+}
+
+// checkpointRecord represents a checkpoint stored for a height
+type checkpointRecord struct {
+	// Stage is the last completed stage, empty when there is nothing to resume
+	Stage   StageName `json:"stage"`
+	Payload []byte    `json:"payload,omitempty"`
+}
+
+// checkpointer saves the payload after designated stages and restores it when a height is retried
+type checkpointer struct {
+	storage   datalake.Storage
+	codec     PayloadCodec
+	stages    map[StageName]bool
+	namespace string
+}
+
+func newCheckpointer(storage datalake.Storage, codec PayloadCodec, stageNames ...StageName) *checkpointer {
+	stages := make(map[StageName]bool, len(stageNames))
+	for _, name := range stageNames {
+		stages[name] = true
+	}
+
+	return &checkpointer{
+		storage: storage,
+		codec:   codec,
+		stages:  stages,
+	}
+}
+
+// shouldSave checks if a checkpoint should be saved after any of the given stages
+func (c *checkpointer) shouldSave(stages []*stage) (StageName, bool) {
+	for _, s := range stages {
+		if s != nil && c.stages[s.Name] {
+			return s.Name, true
+		}
+	}
+	return "", false
+}
+
+// save stores the payload as completed up to the given stage
+func (c *checkpointer) save(height int64, stageName StageName, payload Payload) error {
+	data, err := c.codec.Encode(payload)
+	if err != nil {
+		return err
+	}
+
+	return c.store(height, checkpointRecord{Stage: stageName, Payload: data})
+}
+
+// restore decodes the checkpoint for the given height into the payload.
+// It returns the last completed stage or false if there is nothing to resume.
+func (c *checkpointer) restore(height int64, payload Payload) (StageName, bool, error) {
+	path := c.path(height)
+
+	ok, err := c.storage.IsStored(path...)
+	if err != nil || !ok {
+		return "", false, err
+	}
+
+	data, err := c.storage.Retrieve(path...)
+	if err != nil {
+		return "", false, err
+	}
+
+	var record checkpointRecord
+	if err := json.Unmarshal(data, &record); err != nil {
+		return "", false, err
+	}
+
+	if record.Stage == "" {
+		return "", false, nil
+	}
+
+	if err := c.codec.Decode(record.Payload, payload); err != nil {
+		return "", false, err
+	}
+
+	return record.Stage, true, nil
+}
+
+// clear marks the height as having nothing to resume
+func (c *checkpointer) clear(height int64) error {
+	return c.store(height, checkpointRecord{})
+}
+
+func (c *checkpointer) store(height int64, record checkpointRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	return c.storage.Store(data, c.path(height)...)
+}
+
+func (c *checkpointer) path(height int64) []string {
+	if c.namespace == "" {
+		return []string{"checkpoints", strconv.FormatInt(height, 10)}
+	}
+	return []string{"checkpoints", c.namespace, strconv.FormatInt(height, 10)}
+}
+
+// resumeIndex returns the index of the stage group to resume from.
+// It restores the payload from the checkpoint, if any.
+func (p *pipeline) resumeIndex(height int64, payload Payload) int {
+	if p.checkpointer == nil {
+		return 0
+	}
+
+	stageName, ok, err := p.checkpointer.restore(height, payload)
+	if err != nil {
+		logInfo(fmt.Sprintf("cannot restore checkpoint for height %d: %v", height, err))
+		return 0
+	}
+	if !ok {
+		return 0
+	}
+
+	for i, stages := range p.stages {
+		for _, s := range stages {
+			if s != nil && s.Name == stageName {
+				logInfo(fmt.Sprintf("resuming height %d after stage %s", height, stageName))
+				return i + 1
+			}
+		}
+	}
+
+	logInfo(fmt.Sprintf("cannot resume height %d, stage %s not found on pipeline", height, stageName))
+	return 0
+}
+
+// saveCheckpoint saves the payload if any of the completed stages is designated for checkpoints.
+// It returns true if the checkpoint was saved.
+func (p *pipeline) saveCheckpoint(height int64, stages []*stage, payload Payload) bool {
+	stageName, ok := p.checkpointer.shouldSave(stages)
+	if !ok {
+		return false
+	}
+
+	if err := p.checkpointer.save(height, stageName, payload); err != nil {
+		logInfo(fmt.Sprintf("cannot save checkpoint for height %d after stage %s: %v", height, stageName, err))
+		return false
+	}
+	return true
+}
+
+// clearCheckpoint removes the checkpoint of a successfully processed height
+func (p *pipeline) clearCheckpoint(height int64) {
+	if err := p.checkpointer.clear(height); err != nil {
+		logInfo(fmt.Sprintf("cannot clear checkpoint for height %d: %v", height, err))
+	}
+}
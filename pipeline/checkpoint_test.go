@@ -0,0 +1,245 @@
+package pipeline_test
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+
+	"github.com/figment-networks/indexing-engine/datalake"
+	"github.com/figment-networks/indexing-engine/pipeline"
+	"github.com/figment-networks/indexing-engine/pipeline/mock"
+)
+
+type checkpointPayload struct {
+	Fetched string
+	Parsed  string
+}
+
+func (p *checkpointPayload) MarkAsProcessed() {}
+
+func TestPipeline_SetCheckpoint(t *testing.T) {
+	t.Run("failed height resumes after last checkpointed stage", func(t *testing.T) {
+		ctrl, ctx := gomock.WithContext(context.Background(), t)
+		defer ctrl.Finish()
+
+		dir, err := ioutil.TempDir("", "checkpoint-")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+
+		storage, err := datalake.NewFileStorage(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		payloadFactoryMock := mock.NewMockPayloadFactory(ctrl)
+		payloadFactoryMock.EXPECT().GetPayload(int64(5)).DoAndReturn(func(int64) pipeline.Payload {
+			return &checkpointPayload{}
+		}).Times(3)
+
+		p := pipeline.NewCustom(payloadFactoryMock)
+
+		var fetcherRuns, parserRuns, persistorRuns int
+		var persisted string
+
+		p.AddStage(pipeline.NewCustomStage(pipeline.StageFetcher, pipeline.StageRunnerFunc(
+			func(_ context.Context, payload pipeline.Payload, _ pipeline.TaskValidator) error {
+				fetcherRuns++
+				payload.(*checkpointPayload).Fetched = "block"
+				return nil
+			})))
+		p.AddStage(pipeline.NewCustomStage(pipeline.StageParser, pipeline.StageRunnerFunc(
+			func(_ context.Context, payload pipeline.Payload, _ pipeline.TaskValidator) error {
+				parserRuns++
+				payload.(*checkpointPayload).Parsed = "parsed " + payload.(*checkpointPayload).Fetched
+				return nil
+			})))
+		p.AddStage(pipeline.NewCustomStage(pipeline.StagePersistor, pipeline.StageRunnerFunc(
+			func(_ context.Context, payload pipeline.Payload, _ pipeline.TaskValidator) error {
+				persistorRuns++
+				if persistorRuns == 1 {
+					return errors.New("persistor err")
+				}
+				persisted = payload.(*checkpointPayload).Parsed
+				return nil
+			})))
+
+		p.SetCheckpoint(storage, pipeline.JSONPayloadCodec{}, pipeline.StageFetcher, pipeline.StageParser)
+
+		if _, err := p.Run(ctx, 5, nil); err == nil {
+			t.Fatalf("expected error")
+		}
+
+		if _, err := p.Run(ctx, 5, nil); err != nil {
+			t.Fatalf("did not expect error, got: %v", err)
+		}
+
+		if fetcherRuns != 1 || parserRuns != 1 || persistorRuns != 2 {
+			t.Errorf("unexpected runs, fetcher: %d, parser: %d, persistor: %d", fetcherRuns, parserRuns, persistorRuns)
+		}
+		if persisted != "parsed block" {
+			t.Errorf("expected payload to be restored, got: %q", persisted)
+		}
+
+		// Checkpoint is cleared after the height succeeds
+		if _, err := p.Run(ctx, 5, nil); err != nil {
+			t.Fatalf("did not expect error, got: %v", err)
+		}
+
+		if fetcherRuns != 2 || parserRuns != 2 || persistorRuns != 3 {
+			t.Errorf("unexpected runs, fetcher: %d, parser: %d, persistor: %d", fetcherRuns, parserRuns, persistorRuns)
+		}
+	})
+	t.Run("pipelines sharing a storage keep separate checkpoints", func(t *testing.T) {
+		ctrl, ctx := gomock.WithContext(context.Background(), t)
+		defer ctrl.Finish()
+
+		dir, err := ioutil.TempDir("", "checkpoint-")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+
+		storage, err := datalake.NewFileStorage(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		newPipeline := func(namespace, fetched string, fetcherRuns, persistorRuns *int) pipeline.CustomPipeline {
+			payloadFactoryMock := mock.NewMockPayloadFactory(ctrl)
+			payloadFactoryMock.EXPECT().GetPayload(int64(5)).DoAndReturn(func(int64) pipeline.Payload {
+				return &checkpointPayload{}
+			}).AnyTimes()
+
+			p := pipeline.NewCustom(payloadFactoryMock)
+			p.AddStage(pipeline.NewCustomStage(pipeline.StageFetcher, pipeline.StageRunnerFunc(
+				func(_ context.Context, payload pipeline.Payload, _ pipeline.TaskValidator) error {
+					*fetcherRuns++
+					payload.(*checkpointPayload).Fetched = fetched
+					return nil
+				})))
+			p.AddStage(pipeline.NewCustomStage(pipeline.StagePersistor, pipeline.StageRunnerFunc(
+				func(_ context.Context, payload pipeline.Payload, _ pipeline.TaskValidator) error {
+					*persistorRuns++
+					if *persistorRuns == 1 {
+						return errors.New("persistor err")
+					}
+					if got := payload.(*checkpointPayload).Fetched; got != fetched {
+						t.Errorf("expected payload %q to be restored, got: %q", fetched, got)
+					}
+					return nil
+				})))
+
+			p.SetCheckpointNamespace(namespace)
+			p.SetCheckpoint(storage, pipeline.JSONPayloadCodec{}, pipeline.StageFetcher)
+			return p
+		}
+
+		var fetcherRunsA, persistorRunsA, fetcherRunsB, persistorRunsB int
+		a := newPipeline("a", "block a", &fetcherRunsA, &persistorRunsA)
+		b := newPipeline("b", "block b", &fetcherRunsB, &persistorRunsB)
+
+		// Both pipelines fail height 5 after checkpointing it
+		if _, err := a.Run(ctx, 5, nil); err == nil {
+			t.Fatalf("expected error")
+		}
+		if _, err := b.Run(ctx, 5, nil); err == nil {
+			t.Fatalf("expected error")
+		}
+
+		// Completing the height in one pipeline doesn't clear the checkpoint of the other
+		if _, err := a.Run(ctx, 5, nil); err != nil {
+			t.Fatalf("did not expect error, got: %v", err)
+		}
+		if _, err := b.Run(ctx, 5, nil); err != nil {
+			t.Fatalf("did not expect error, got: %v", err)
+		}
+
+		if fetcherRunsA != 1 || fetcherRunsB != 1 {
+			t.Errorf("expected both pipelines to resume, fetcher runs a: %d, b: %d", fetcherRunsA, fetcherRunsB)
+		}
+	})
+	t.Run("setup and always-run stages run when resuming", func(t *testing.T) {
+		ctrl, ctx := gomock.WithContext(context.Background(), t)
+		defer ctrl.Finish()
+
+		dir, err := ioutil.TempDir("", "checkpoint-")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+
+		storage, err := datalake.NewFileStorage(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		payloadFactoryMock := mock.NewMockPayloadFactory(ctrl)
+		payloadFactoryMock.EXPECT().GetPayload(int64(5)).DoAndReturn(func(int64) pipeline.Payload {
+			return &checkpointPayload{}
+		}).Times(2)
+
+		p := pipeline.NewCustom(payloadFactoryMock)
+
+		var locks, fetcherRuns, validatorRuns, persistorRuns int
+
+		p.AddStage(pipeline.NewCustomStage(pipeline.StageSetup, pipeline.StageRunnerFunc(
+			func(context.Context, pipeline.Payload, pipeline.TaskValidator) error {
+				locks++
+				return nil
+			})))
+		p.AddStage(pipeline.NewCustomStage(pipeline.StageFetcher, pipeline.StageRunnerFunc(
+			func(_ context.Context, payload pipeline.Payload, _ pipeline.TaskValidator) error {
+				fetcherRuns++
+				payload.(*checkpointPayload).Fetched = "block"
+				return nil
+			})))
+		p.AddStage(pipeline.NewCustomStage(pipeline.StageValidator, pipeline.StageRunnerFunc(
+			func(context.Context, pipeline.Payload, pipeline.TaskValidator) error {
+				validatorRuns++
+				return nil
+			})))
+		p.AddStage(pipeline.NewCustomStage(pipeline.StageParser, pipeline.StageRunnerFunc(
+			func(context.Context, pipeline.Payload, pipeline.TaskValidator) error {
+				return nil
+			})))
+		p.AddStage(pipeline.NewCustomStage(pipeline.StagePersistor, pipeline.StageRunnerFunc(
+			func(context.Context, pipeline.Payload, pipeline.TaskValidator) error {
+				persistorRuns++
+				if persistorRuns == 1 {
+					return errors.New("persistor err")
+				}
+				return nil
+			})))
+		p.AddStage(pipeline.NewCustomStage(pipeline.StageCleanup, pipeline.StageRunnerFunc(
+			func(context.Context, pipeline.Payload, pipeline.TaskValidator) error {
+				locks--
+				return nil
+			})))
+
+		p.AlwaysRunStage(pipeline.StageValidator)
+		p.SetCheckpoint(storage, pipeline.JSONPayloadCodec{}, pipeline.StageParser)
+
+		if _, err := p.Run(ctx, 5, nil); err == nil {
+			t.Fatalf("expected error")
+		}
+		if locks != 0 {
+			t.Errorf("expected cleanup to release the lock taken by setup, locks: %d", locks)
+		}
+
+		if _, err := p.Run(ctx, 5, nil); err != nil {
+			t.Fatalf("did not expect error, got: %v", err)
+		}
+		if locks != 0 {
+			t.Errorf("expected setup to run when resuming, locks: %d", locks)
+		}
+		if fetcherRuns != 1 || validatorRuns != 2 {
+			t.Errorf("unexpected runs, fetcher: %d, validator: %d", fetcherRuns, validatorRuns)
+		}
+	})
+}
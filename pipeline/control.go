@@ -0,0 +1,186 @@
+package pipeline
+
+import (
+	"context"
+	"sync"
+)
+
+// Status represents the state of a pipeline as seen by an operator
+type Status struct {
+	Running bool `json:"running"`
+	Paused  bool `json:"paused"`
+
+	// CurrentHeight is the height being processed or the most recently processed one
+	CurrentHeight int64 `json:"current_height"`
+
+	// LastError is the most recent error returned while processing a height
+	LastError       string `json:"last_error,omitempty"`
+	LastErrorHeight int64  `json:"last_error_height,omitempty"`
+
+	HeightsCompleted int64 `json:"heights_completed"`
+	HeightsFailed    int64 `json:"heights_failed"`
+	HeightsSkipped   int64 `json:"heights_skipped"`
+
+	// LastHeightStat holds the stat of the most recently finished height
+	LastHeightStat *Stat `json:"last_height_stat,omitempty"`
+
+	StagesBlacklist []StageName `json:"stages_blacklist"`
+	TaskWhitelist   []TaskName  `json:"task_whitelist"`
+}
+
+// control holds the runtime state that can be changed while the pipeline is running.
+// Every change is applied at a height boundary.
+type control struct {
+	mu sync.Mutex
+
+	paused   bool
+	resumeCh chan struct{}
+
+	pendingStagesBlacklist *[]StageName
+	pendingTaskWhitelist   *[]TaskName
+
+	status Status
+}
+
+func newControl() *control {
+	return &control{}
+}
+
+// pause requests the pipeline to stop before processing the next height
+func (c *control) pause() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.paused {
+		c.paused = true
+		c.resumeCh = make(chan struct{})
+	}
+}
+
+// resume lets a paused pipeline continue processing heights
+func (c *control) resume() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.paused {
+		c.paused = false
+		close(c.resumeCh)
+	}
+}
+
+// setStagesBlacklist schedules a new stages blacklist for the next height
+func (c *control) setStagesBlacklist(stages []StageName) {
+	c.mu.Lock()
+	c.pendingStagesBlacklist = &stages
+	c.mu.Unlock()
+}
+
+// setTaskWhitelist schedules a new task whitelist for the next height
+func (c *control) setTaskWhitelist(tasks []TaskName) {
+	c.mu.Lock()
+	c.pendingTaskWhitelist = &tasks
+	c.mu.Unlock()
+}
+
+// waitIfPaused blocks until the pipeline is resumed or the context is done
+func (c *control) waitIfPaused(ctx context.Context) error {
+	for {
+		c.mu.Lock()
+		if !c.paused {
+			c.mu.Unlock()
+			return nil
+		}
+		resumeCh := c.resumeCh
+		c.mu.Unlock()
+
+		select {
+		case <-resumeCh:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// applyOptions returns options with all pending changes applied.
+// The given options are never modified.
+func (c *control) applyOptions(options *Options) *Options {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.pendingStagesBlacklist != nil || c.pendingTaskWhitelist != nil {
+		updated := Options{}
+		if options != nil {
+			updated = *options
+		}
+
+		if c.pendingStagesBlacklist != nil {
+			updated.StagesBlacklist = *c.pendingStagesBlacklist
+			c.pendingStagesBlacklist = nil
+		}
+		if c.pendingTaskWhitelist != nil {
+			updated.TaskWhitelist = *c.pendingTaskWhitelist
+			c.pendingTaskWhitelist = nil
+		}
+
+		options = &updated
+	}
+
+	if options != nil {
+		c.status.StagesBlacklist = options.StagesBlacklist
+		c.status.TaskWhitelist = options.TaskWhitelist
+	} else {
+		c.status.StagesBlacklist = nil
+		c.status.TaskWhitelist = nil
+	}
+
+	return options
+}
+
+// setRunning marks the pipeline as running or stopped
+func (c *control) setRunning(running bool) {
+	c.mu.Lock()
+	c.status.Running = running
+	c.mu.Unlock()
+}
+
+// heightStarted records the start of processing of a height
+func (c *control) heightStarted(height int64) *Stat {
+	c.mu.Lock()
+	c.status.CurrentHeight = height
+	c.mu.Unlock()
+
+	return NewStat()
+}
+
+// heightFinished records the result of processing of a height
+func (c *control) heightFinished(height int64, stat *Stat, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if IsSkipHeight(err) {
+		c.status.HeightsSkipped++
+	} else if err != nil {
+		c.status.HeightsFailed++
+		c.status.LastError = err.Error()
+		c.status.LastErrorHeight = height
+	} else {
+		c.status.HeightsCompleted++
+	}
+
+	stat.SetCompleted(err == nil)
+	c.status.LastHeightStat = stat
+}
+
+// snapshot returns a copy of the current status
+func (c *control) snapshot() Status {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	status := c.status
+	status.Paused = c.paused
+	if status.LastHeightStat != nil {
+		stat := *status.LastHeightStat
+		status.LastHeightStat = &stat
+	}
+	return status
+}
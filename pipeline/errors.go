@@ -0,0 +1,108 @@
+package pipeline
+
+import (
+	"errors"
+
+	"github.com/hashicorp/go-multierror"
+)
+
+// TransientError marks an error as temporary, so the operation that caused it can be retried
+type TransientError struct {
+	Err error
+}
+
+func (e *TransientError) Error() string { return e.Err.Error() }
+func (e *TransientError) Unwrap() error { return e.Err }
+
+// PermanentError marks an error as final, so the operation that caused it is never retried
+type PermanentError struct {
+	Err error
+}
+
+func (e *PermanentError) Error() string { return e.Err.Error() }
+func (e *PermanentError) Unwrap() error { return e.Err }
+
+// SkipHeightError marks a height as deliberately skipped.
+// Start moves on to the next height instead of stopping the pipeline.
+type SkipHeightError struct {
+	Err error
+}
+
+func (e *SkipHeightError) Error() string { return e.Err.Error() }
+func (e *SkipHeightError) Unwrap() error { return e.Err }
+
+// Transient wraps err into TransientError. It returns nil if err is nil.
+func Transient(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &TransientError{Err: err}
+}
+
+// Permanent wraps err into PermanentError. It returns nil if err is nil.
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &PermanentError{Err: err}
+}
+
+// SkipHeight wraps err into SkipHeightError. It returns nil if err is nil.
+func SkipHeight(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &SkipHeightError{Err: err}
+}
+
+// IsTransient checks if any error in err's chain is a TransientError
+func IsTransient(err error) bool {
+	var target *TransientError
+	return errors.As(err, &target)
+}
+
+// IsPermanent checks if any error in err's chain is a PermanentError
+func IsPermanent(err error) bool {
+	var target *PermanentError
+	return errors.As(err, &target)
+}
+
+// IsSkipHeight checks if any error in err's chain is a SkipHeightError.
+// Errors combined with multierror, e.g. by concurrent stages, are skip height errors only if all of them are,
+// so real errors are not dropped with the skipped height.
+func IsSkipHeight(err error) bool {
+	for err != nil {
+		switch e := err.(type) {
+		case *SkipHeightError:
+			return true
+		case *multierror.Error:
+			if len(e.Errors) == 0 {
+				return false
+			}
+			for _, err := range e.Errors {
+				if !IsSkipHeight(err) {
+					return false
+				}
+			}
+			return true
+		}
+		err = errors.Unwrap(err)
+	}
+	return false
+}
+
+// isRetryable determines if the operation which returned err should be retried.
+// Permanent and skip height errors are never retried, transient errors always are.
+// Other errors are classified by isTransient, if provided.
+func isRetryable(err error, isTransient func(error) bool) bool {
+	switch {
+	case IsPermanent(err), IsSkipHeight(err):
+		return false
+	case IsTransient(err):
+		return true
+	case isTransient != nil:
+		return isTransient(err)
+	default:
+		return false
+	}
+}
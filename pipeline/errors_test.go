@@ -0,0 +1,220 @@
+package pipeline_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/hashicorp/go-multierror"
+
+	"github.com/figment-networks/indexing-engine/pipeline"
+	"github.com/figment-networks/indexing-engine/pipeline/mock"
+)
+
+func TestErrors_Classification(t *testing.T) {
+	baseErr := errors.New("test err")
+
+	tests := []struct {
+		description string
+		err         error
+		transient   bool
+		permanent   bool
+		skipHeight  bool
+	}{
+		{"plain error", baseErr, false, false, false},
+		{"transient error", pipeline.Transient(baseErr), true, false, false},
+		{"permanent error", pipeline.Permanent(baseErr), false, true, false},
+		{"skip height error", pipeline.SkipHeight(baseErr), false, false, true},
+		{"multierror with transient error", multierror.Append(baseErr, pipeline.Transient(baseErr)), true, false, false},
+		{"multierror with skip height error", multierror.Append(baseErr, pipeline.SkipHeight(baseErr)), false, false, false},
+		{"multierror of skip height errors", multierror.Append(pipeline.SkipHeight(baseErr), pipeline.SkipHeight(baseErr)), false, false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.description, func(t *testing.T) {
+			if got := pipeline.IsTransient(tt.err); got != tt.transient {
+				t.Errorf("IsTransient exp: %v, got: %v", tt.transient, got)
+			}
+			if got := pipeline.IsPermanent(tt.err); got != tt.permanent {
+				t.Errorf("IsPermanent exp: %v, got: %v", tt.permanent, got)
+			}
+			if got := pipeline.IsSkipHeight(tt.err); got != tt.skipHeight {
+				t.Errorf("IsSkipHeight exp: %v, got: %v", tt.skipHeight, got)
+			}
+			if !errors.Is(tt.err, baseErr) {
+				t.Errorf("expected wrapped error to match base error")
+			}
+		})
+	}
+
+	t.Run("wrapping nil returns nil", func(t *testing.T) {
+		if pipeline.Transient(nil) != nil || pipeline.Permanent(nil) != nil || pipeline.SkipHeight(nil) != nil {
+			t.Errorf("expected nil")
+		}
+	})
+}
+
+func TestErrors_RetryingTask(t *testing.T) {
+	t.Run("retries transient error without classifier", func(t *testing.T) {
+		ctrl, ctx := gomock.WithContext(context.Background(), t)
+		defer ctrl.Finish()
+
+		payloadMock := mock.NewMockPayload(ctrl)
+
+		task := mock.NewMockTask(ctrl)
+		task.EXPECT().GetName().Return("task").Times(3)
+		gomock.InOrder(
+			task.EXPECT().Run(ctx, payloadMock).Return(pipeline.Transient(errors.New("test err"))),
+			task.EXPECT().Run(ctx, payloadMock).Return(nil),
+		)
+
+		s := pipeline.NewStageWithTasks("test_stage", pipeline.RetryingTask(task, nil, 3))
+
+		if err := s.Run(ctx, payloadMock, nil); err != nil {
+			t.Errorf("should not return error")
+		}
+	})
+
+	t.Run("does not retry permanent error", func(t *testing.T) {
+		ctrl, ctx := gomock.WithContext(context.Background(), t)
+		defer ctrl.Finish()
+
+		payloadMock := mock.NewMockPayload(ctrl)
+
+		task := mock.NewMockTask(ctrl)
+		task.EXPECT().GetName().Return("task").Times(2)
+		task.EXPECT().Run(ctx, payloadMock).Return(pipeline.Permanent(errors.New("test err"))).Times(1)
+
+		s := pipeline.NewStageWithTasks("test_stage", pipeline.RetryingTask(task, func(err error) bool {
+			return true
+		}, 3))
+
+		if err := s.Run(ctx, payloadMock, nil); !pipeline.IsPermanent(err) {
+			t.Errorf("should return permanent error")
+		}
+	})
+
+	t.Run("does not retry plain error without classifier", func(t *testing.T) {
+		ctrl, ctx := gomock.WithContext(context.Background(), t)
+		defer ctrl.Finish()
+
+		payloadMock := mock.NewMockPayload(ctrl)
+
+		task := mock.NewMockTask(ctrl)
+		task.EXPECT().GetName().Return("task").Times(2)
+		task.EXPECT().Run(ctx, payloadMock).Return(errors.New("test err")).Times(1)
+
+		s := pipeline.NewStageWithTasks("test_stage", pipeline.RetryingTask(task, nil, 3))
+
+		if err := s.Run(ctx, payloadMock, nil); err == nil {
+			t.Errorf("should return error")
+		}
+	})
+}
+
+func TestErrors_RetryStage(t *testing.T) {
+	t.Run("retries transient error without classifier", func(t *testing.T) {
+		ctrl, ctx := gomock.WithContext(context.Background(), t)
+		defer ctrl.Finish()
+
+		payloadFactoryMock := mock.NewMockPayloadFactory(ctrl)
+		payloadFactoryMock.EXPECT().GetPayload(gomock.Any()).Return(&payloadMock{}).Times(1)
+
+		p := pipeline.NewCustom(payloadFactoryMock)
+
+		task := mock.NewMockTask(ctrl)
+		task.EXPECT().GetName().Return("task").Times(4)
+		gomock.InOrder(
+			task.EXPECT().Run(gomock.Any(), gomock.Any()).Return(pipeline.Transient(errors.New("test err"))),
+			task.EXPECT().Run(gomock.Any(), gomock.Any()).Return(nil),
+		)
+
+		p.AddStage(pipeline.NewStageWithTasks("test_stage", task))
+		p.RetryStage("test_stage", nil, 3)
+
+		if _, err := p.Run(ctx, 1, nil); err != nil {
+			t.Errorf("should not return error")
+		}
+	})
+}
+
+func TestErrors_SkipHeight(t *testing.T) {
+	t.Run("pipeline continues after skipped height", func(t *testing.T) {
+		ctrl, ctx := gomock.WithContext(context.Background(), t)
+		defer ctrl.Finish()
+
+		payloadFactoryMock := mock.NewMockPayloadFactory(ctrl)
+		payloadFactoryMock.EXPECT().GetPayload(gomock.Any()).Return(&payloadMock{}).Times(3)
+
+		p := pipeline.NewCustom(payloadFactoryMock)
+
+		task := mock.NewMockTask(ctrl)
+		task.EXPECT().GetName().Return("task").Times(6)
+		gomock.InOrder(
+			task.EXPECT().Run(gomock.Any(), gomock.Any()).Return(nil),
+			task.EXPECT().Run(gomock.Any(), gomock.Any()).Return(pipeline.SkipHeight(errors.New("no data"))),
+			task.EXPECT().Run(gomock.Any(), gomock.Any()).Return(nil),
+		)
+		p.AddStage(pipeline.NewStageWithTasks(pipeline.StageFetcher, task))
+
+		sinkMock := mock.NewMockSink(ctrl)
+		sinkMock.EXPECT().Consume(gomock.Any(), gomock.Any()).Return(nil).Times(2)
+
+		events := p.Subscribe(20)
+		defer p.Unsubscribe(events)
+
+		if err := p.Start(ctx, &sourceMock{1, 3, 1, false}, sinkMock, nil); err != nil {
+			t.Fatalf("did not expect error, got: %v", err)
+		}
+
+		var skipped []int64
+		for len(events) > 0 {
+			if e := <-events; e.Type == pipeline.EventHeightSkipped {
+				skipped = append(skipped, e.Height)
+			}
+		}
+		if len(skipped) != 1 || skipped[0] != 2 {
+			t.Errorf("expected height 2 to be skipped, got: %v", skipped)
+		}
+
+		if status := p.Status(); status.HeightsCompleted != 2 || status.HeightsSkipped != 1 || status.HeightsFailed != 0 {
+			t.Errorf("unexpected status: %+v", status)
+		}
+	})
+
+	t.Run("real error from concurrent stage is not dropped", func(t *testing.T) {
+		ctrl, ctx := gomock.WithContext(context.Background(), t)
+		defer ctrl.Finish()
+
+		payloadFactoryMock := mock.NewMockPayloadFactory(ctrl)
+		payloadFactoryMock.EXPECT().GetPayload(gomock.Any()).Return(&payloadMock{}).Times(1)
+
+		p := pipeline.NewCustom(payloadFactoryMock)
+
+		skippingTask := mock.NewMockTask(ctrl)
+		skippingTask.EXPECT().GetName().Return("skippingTask").AnyTimes()
+		skippingTask.EXPECT().Run(gomock.Any(), gomock.Any()).Return(pipeline.SkipHeight(errors.New("no data"))).Times(1)
+
+		failingTask := mock.NewMockTask(ctrl)
+		failingTask.EXPECT().GetName().Return("failingTask").AnyTimes()
+		failingTask.EXPECT().Run(gomock.Any(), gomock.Any()).Return(errors.New("db down")).Times(1)
+
+		p.AddConcurrentStages(
+			pipeline.NewStageWithTasks(pipeline.StageFetcher, skippingTask),
+			pipeline.NewStageWithTasks(pipeline.StageParser, failingTask),
+		)
+
+		sinkMock := mock.NewMockSink(ctrl)
+		sinkMock.EXPECT().Consume(gomock.Any(), gomock.Any()).Times(0)
+
+		err := p.Start(ctx, &sourceMock{1, 3, 1, false}, sinkMock, nil)
+		if err == nil || pipeline.IsSkipHeight(err) {
+			t.Fatalf("expected real error, got: %v", err)
+		}
+
+		if status := p.Status(); status.HeightsFailed != 1 || status.HeightsSkipped != 0 {
+			t.Errorf("unexpected status: %+v", status)
+		}
+	})
+}
@@ -0,0 +1,165 @@
+package pipeline
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+const (
+	// EventHeightStarted is published when the pipeline starts processing a height
+	EventHeightStarted EventType = "height_started"
+
+	// EventStageStarted is published when a stage starts running
+	EventStageStarted EventType = "stage_started"
+
+	// EventStageFinished is published when a stage finishes running, successfully or not
+	EventStageFinished EventType = "stage_finished"
+
+	// EventTaskRetried is published when a retrying task or stage is about to run again
+	EventTaskRetried EventType = "task_retried"
+
+	// EventHeightCompleted is published when a height has been processed successfully
+	EventHeightCompleted EventType = "height_completed"
+
+	// EventHeightFailed is published when processing of a height returns an error
+	EventHeightFailed EventType = "height_failed"
+
+	// EventHeightSkipped is published when a height is skipped with a SkipHeight error
+	EventHeightSkipped EventType = "height_skipped"
+
+	// EventPipelineStopped is published when Start returns
+	EventPipelineStopped EventType = "pipeline_stopped"
+)
+
+// ctxEventScope is the context key under which the current event scope is stored
+const ctxEventScope = ctxKey("event_scope")
+
+type ctxKey string
+
+// EventType describes what happened in the pipeline
+type EventType string
+
+// Event represents a single pipeline lifecycle event
+type Event struct {
+	Type   EventType
+	Time   time.Time
+	Height int64
+
+	// Stage is set for stage and retry events
+	Stage StageName
+
+	// Task is set for task retry events
+	Task string
+
+	// Attempt is the number of the failed attempt for retry events
+	Attempt int
+
+	// Err is set for failed stages, retries, failed or skipped heights and stopped pipelines
+	Err error
+}
+
+// eventBus fans out published events to all subscribers without blocking the publisher
+type eventBus struct {
+	mu          sync.RWMutex
+	subscribers map[<-chan Event]chan Event
+}
+
+func newEventBus() *eventBus {
+	return &eventBus{
+		subscribers: make(map[<-chan Event]chan Event),
+	}
+}
+
+// subscribe registers a new subscriber channel with the given buffer size
+func (b *eventBus) subscribe(bufferSize int) <-chan Event {
+	ch := make(chan Event, bufferSize)
+
+	b.mu.Lock()
+	b.subscribers[ch] = ch
+	b.mu.Unlock()
+
+	return ch
+}
+
+// unsubscribe removes the subscriber and closes its channel
+func (b *eventBus) unsubscribe(ch <-chan Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if sub, ok := b.subscribers[ch]; ok {
+		delete(b.subscribers, ch)
+		close(sub)
+	}
+}
+
+// publish delivers the event to every subscriber that has room for it.
+// Events are dropped for subscribers that are not keeping up.
+func (b *eventBus) publish(e Event) {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	for _, ch := range b.subscribers {
+		select {
+		case ch <- e:
+		default:
+			eventsDroppedMetric.WithLabels(string(e.Type)).Inc()
+		}
+	}
+}
+
+// eventScope holds the event bus together with the height and stage being processed
+type eventScope struct {
+	bus    *eventBus
+	height int64
+	stage  StageName
+}
+
+// withEventHeight returns a context publishing events for the given height
+func withEventHeight(ctx context.Context, bus *eventBus, height int64) context.Context {
+	return context.WithValue(ctx, ctxEventScope, eventScope{bus: bus, height: height})
+}
+
+// withEventStage returns a context publishing events for the given stage
+func withEventStage(ctx context.Context, stageName StageName) context.Context {
+	scope, ok := ctx.Value(ctxEventScope).(eventScope)
+	if !ok {
+		return ctx
+	}
+	scope.stage = stageName
+	return context.WithValue(ctx, ctxEventScope, scope)
+}
+
+// eventHeight returns the height stored in the event scope of the context
+func eventHeight(ctx context.Context) int64 {
+	scope, _ := ctx.Value(ctxEventScope).(eventScope)
+	return scope.height
+}
+
+// eventStage returns the stage stored in the event scope of the context
+func eventStage(ctx context.Context) StageName {
+	scope, _ := ctx.Value(ctxEventScope).(eventScope)
+	return scope.stage
+}
+
+// publishEvent publishes the event on the bus stored in the context, if any.
+// Height and stage are filled in from the context when not set.
+func publishEvent(ctx context.Context, e Event) {
+	scope, ok := ctx.Value(ctxEventScope).(eventScope)
+	if !ok || scope.bus == nil {
+		return
+	}
+
+	if e.Height == 0 {
+		e.Height = scope.height
+	}
+	if e.Stage == "" {
+		e.Stage = scope.stage
+	}
+
+	scope.bus.publish(e)
+}
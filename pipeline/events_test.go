@@ -0,0 +1,134 @@
+package pipeline_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+
+	"github.com/figment-networks/indexing-engine/pipeline"
+	"github.com/figment-networks/indexing-engine/pipeline/mock"
+)
+
+func TestPipeline_Subscribe(t *testing.T) {
+	t.Run("subscriber receives lifecycle events in order", func(t *testing.T) {
+		ctrl, ctx := gomock.WithContext(context.Background(), t)
+		defer ctrl.Finish()
+
+		payloadFactoryMock := mock.NewMockPayloadFactory(ctrl)
+		payloadFactoryMock.EXPECT().GetPayload(gomock.Any()).Return(&payloadMock{}).Times(1)
+
+		p := pipeline.NewCustom(payloadFactoryMock)
+
+		task := mock.NewMockTask(ctrl)
+		task.EXPECT().GetName().Return("task").Times(2)
+		task.EXPECT().Run(gomock.Any(), gomock.Any()).Return(nil).Times(1)
+		p.AddStage(pipeline.NewStageWithTasks(pipeline.StageFetcher, task))
+
+		sinkMock := mock.NewMockSink(ctrl)
+		sinkMock.EXPECT().Consume(gomock.Any(), gomock.Any()).Return(nil).Times(1)
+
+		events := p.Subscribe(10)
+		defer p.Unsubscribe(events)
+
+		if err := p.Start(ctx, &sourceMock{5, 5, 5, false}, sinkMock, nil); err != nil {
+			t.Fatalf("did not expect error")
+		}
+
+		expected := []pipeline.Event{
+			{Type: pipeline.EventHeightStarted, Height: 5},
+			{Type: pipeline.EventStageStarted, Height: 5, Stage: pipeline.StageFetcher},
+			{Type: pipeline.EventStageFinished, Height: 5, Stage: pipeline.StageFetcher},
+			{Type: pipeline.EventHeightCompleted, Height: 5},
+			{Type: pipeline.EventPipelineStopped, Height: 5},
+		}
+
+		for _, exp := range expected {
+			e := <-events
+			if e.Type != exp.Type || e.Height != exp.Height || e.Stage != exp.Stage || e.Err != nil {
+				t.Errorf("exp: %+v, got: %+v", exp, e)
+			}
+		}
+	})
+
+	t.Run("subscriber receives retry and failure events", func(t *testing.T) {
+		ctrl, ctx := gomock.WithContext(context.Background(), t)
+		defer ctrl.Finish()
+
+		taskErr := errors.New("task err")
+
+		payloadFactoryMock := mock.NewMockPayloadFactory(ctrl)
+		payloadFactoryMock.EXPECT().GetPayload(gomock.Any()).Return(&payloadMock{}).Times(1)
+
+		p := pipeline.NewCustom(payloadFactoryMock)
+
+		task := mock.NewMockTask(ctrl)
+		task.EXPECT().GetName().Return("task").Times(3)
+		task.EXPECT().Run(gomock.Any(), gomock.Any()).Return(taskErr).Times(2)
+		p.AddStage(pipeline.NewStageWithTasks(pipeline.StageFetcher, pipeline.RetryingTask(task, func(err error) bool {
+			return true
+		}, 2)))
+
+		events := p.Subscribe(10)
+		defer p.Unsubscribe(events)
+
+		if _, err := p.Run(ctx, 7, nil); err != taskErr {
+			t.Fatalf("expected error")
+		}
+
+		expected := []pipeline.Event{
+			{Type: pipeline.EventHeightStarted, Height: 7},
+			{Type: pipeline.EventStageStarted, Height: 7, Stage: pipeline.StageFetcher},
+			{Type: pipeline.EventTaskRetried, Height: 7, Stage: pipeline.StageFetcher, Task: "task", Attempt: 1, Err: taskErr},
+			{Type: pipeline.EventStageFinished, Height: 7, Stage: pipeline.StageFetcher, Err: taskErr},
+			{Type: pipeline.EventHeightFailed, Height: 7, Err: taskErr},
+		}
+
+		for _, exp := range expected {
+			e := <-events
+			if e.Type != exp.Type || e.Height != exp.Height || e.Stage != exp.Stage ||
+				e.Task != exp.Task || e.Attempt != exp.Attempt || e.Err != exp.Err {
+				t.Errorf("exp: %+v, got: %+v", exp, e)
+			}
+		}
+	})
+
+	t.Run("slow subscriber does not block pipeline", func(t *testing.T) {
+		ctrl, ctx := gomock.WithContext(context.Background(), t)
+		defer ctrl.Finish()
+
+		payloadFactoryMock := mock.NewMockPayloadFactory(ctrl)
+		payloadFactoryMock.EXPECT().GetPayload(gomock.Any()).Return(&payloadMock{}).Times(3)
+
+		p := pipeline.NewDefault(payloadFactoryMock)
+
+		sinkMock := mock.NewMockSink(ctrl)
+		sinkMock.EXPECT().Consume(gomock.Any(), gomock.Any()).Return(nil).Times(3)
+
+		events := p.Subscribe(1)
+		defer p.Unsubscribe(events)
+
+		if err := p.Start(ctx, &sourceMock{1, 3, 1, false}, sinkMock, nil); err != nil {
+			t.Fatalf("did not expect error")
+		}
+
+		if e := <-events; e.Type != pipeline.EventHeightStarted || e.Height != 1 {
+			t.Errorf("expected first event to be kept, got: %+v", e)
+		}
+	})
+
+	t.Run("unsubscribe closes channel", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		p := pipeline.NewCustom(mock.NewMockPayloadFactory(ctrl))
+
+		events := p.Subscribe(1)
+		p.Unsubscribe(events)
+
+		if _, ok := <-events; ok {
+			t.Errorf("expected channel to be closed")
+		}
+	})
+}
@@ -49,17 +49,16 @@ func StartPipeline() error {
 	// Set aggregator stage
 	p.SetTasks(pipeline.StageAggregator, NewAggregatorTask())
 
-	// Add custom stage before existing one
-	// Demonstrates how to use func as a stage runner without a need to use structs
-	beforeFetcherFunc := pipeline.StageRunnerFunc(func(ctx context.Context, p pipeline.Payload, f pipeline.TaskValidator) error {
-		payload := (p).(*payload)
-		fmt.Println("task: ", "BeforeFetcher", payload.CurrentHeight)
-		return nil
+	// Add lifecycle hooks
+	// Demonstrates how to run code before and after every height without adding custom stages
+	p.AddHooks(pipeline.Hooks{
+		OnHeightStart: func(height int64) {
+			fmt.Println("hook: ", "OnHeightStart", height)
+		},
+		OnHeightError: func(height int64, err error) {
+			fmt.Println("hook: ", "OnHeightError", height, err)
+		},
 	})
-	p.AddStageBefore(
-		pipeline.StageFetcher,
-		pipeline.NewCustomStage("BeforeFetcher", beforeFetcherFunc),
-	)
 
 	// Add custom stage after existing one
 	// Demonstrates how to use func as a stage runner without a need to use structs
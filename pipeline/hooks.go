@@ -0,0 +1,67 @@
+package pipeline
+
+import "context"
+
+// Hooks holds callbacks invoked by the pipeline at points of its lifecycle.
+// Any of the callbacks can be nil. Hooks are invoked synchronously, so they should return quickly.
+// Height hooks can be invoked concurrently by RunRange with parallelism and by concurrent calls to Run.
+type Hooks struct {
+	// OnStart is invoked before the first height is processed
+	OnStart func(ctx context.Context)
+
+	// OnHeightStart is invoked before the stages of a height are run
+	OnHeightStart func(height int64)
+
+	// OnHeightComplete is invoked after a height has been processed successfully
+	OnHeightComplete func(payload Payload, stat *Stat)
+
+	// OnHeightError is invoked after processing of a height returns an error, including SkipHeight errors
+	OnHeightError func(height int64, err error)
+
+	// OnFinish is invoked when the pipeline is done, with the error returned by Start or Run
+	// or with the combined errors of all heights processed by RunRange
+	OnFinish func(err error)
+}
+
+// hooks holds all registered hooks in the order of registration
+type hooks []Hooks
+
+func (hs hooks) start(ctx context.Context) {
+	for _, h := range hs {
+		if h.OnStart != nil {
+			h.OnStart(ctx)
+		}
+	}
+}
+
+func (hs hooks) heightStart(height int64) {
+	for _, h := range hs {
+		if h.OnHeightStart != nil {
+			h.OnHeightStart(height)
+		}
+	}
+}
+
+func (hs hooks) heightComplete(payload Payload, stat *Stat) {
+	for _, h := range hs {
+		if h.OnHeightComplete != nil {
+			h.OnHeightComplete(payload, stat)
+		}
+	}
+}
+
+func (hs hooks) heightError(height int64, err error) {
+	for _, h := range hs {
+		if h.OnHeightError != nil {
+			h.OnHeightError(height, err)
+		}
+	}
+}
+
+func (hs hooks) finish(err error) {
+	for _, h := range hs {
+		if h.OnFinish != nil {
+			h.OnFinish(err)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package pipeline_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+
+	"github.com/figment-networks/indexing-engine/pipeline"
+	"github.com/figment-networks/indexing-engine/pipeline/mock"
+)
+
+func recordingHooks(calls *[]string) pipeline.Hooks {
+	return pipeline.Hooks{
+		OnStart: func(context.Context) {
+			*calls = append(*calls, "start")
+		},
+		OnHeightStart: func(height int64) {
+			*calls = append(*calls, fmt.Sprintf("height_start %d", height))
+		},
+		OnHeightComplete: func(_ pipeline.Payload, stat *pipeline.Stat) {
+			*calls = append(*calls, fmt.Sprintf("height_complete %v", stat.Success))
+		},
+		OnHeightError: func(height int64, err error) {
+			*calls = append(*calls, fmt.Sprintf("height_error %d %v", height, err))
+		},
+		OnFinish: func(err error) {
+			*calls = append(*calls, fmt.Sprintf("finish %v", err))
+		},
+	}
+}
+
+func TestPipeline_AddHooks(t *testing.T) {
+	t.Run("hooks are invoked by Start", func(t *testing.T) {
+		ctrl, ctx := gomock.WithContext(context.Background(), t)
+		defer ctrl.Finish()
+
+		payloadFactoryMock := mock.NewMockPayloadFactory(ctrl)
+		payloadFactoryMock.EXPECT().GetPayload(gomock.Any()).Return(&payloadMock{}).Times(2)
+
+		p := pipeline.NewCustom(payloadFactoryMock)
+
+		task := mock.NewMockTask(ctrl)
+		task.EXPECT().GetName().Return("task").Times(4)
+		gomock.InOrder(
+			task.EXPECT().Run(gomock.Any(), gomock.Any()).Return(nil),
+			task.EXPECT().Run(gomock.Any(), gomock.Any()).Return(errors.New("task err")),
+		)
+		p.AddStage(pipeline.NewStageWithTasks(pipeline.StageFetcher, task))
+
+		sinkMock := mock.NewMockSink(ctrl)
+		sinkMock.EXPECT().Consume(gomock.Any(), gomock.Any()).Return(nil).Times(1)
+
+		var calls []string
+		p.AddHooks(recordingHooks(&calls))
+
+		if err := p.Start(ctx, &sourceMock{1, 2, 1, false}, sinkMock, nil); err == nil {
+			t.Fatalf("expected error")
+		}
+
+		expected := []string{
+			"start",
+			"height_start 1",
+			"height_complete true",
+			"height_start 2",
+			"height_error 2 task err",
+			"finish task err",
+		}
+		if !reflect.DeepEqual(calls, expected) {
+			t.Errorf("exp: %v, got: %v", expected, calls)
+		}
+	})
+
+	t.Run("hooks are invoked by Run in order of registration", func(t *testing.T) {
+		ctrl, ctx := gomock.WithContext(context.Background(), t)
+		defer ctrl.Finish()
+
+		payloadFactoryMock := mock.NewMockPayloadFactory(ctrl)
+		payloadFactoryMock.EXPECT().GetPayload(gomock.Any()).Return(&payloadMock{}).Times(1)
+
+		p := pipeline.NewCustom(payloadFactoryMock)
+		p.AddStage(pipeline.NewCustomStage(pipeline.StageFetcher, pipeline.StageRunnerFunc(
+			func(context.Context, pipeline.Payload, pipeline.TaskValidator) error {
+				return nil
+			})))
+
+		var calls []string
+		p.AddHooks(recordingHooks(&calls))
+		p.AddHooks(pipeline.Hooks{
+			OnFinish: func(error) {
+				calls = append(calls, "second finish")
+			},
+		})
+
+		if _, err := p.Run(ctx, 3, nil); err != nil {
+			t.Fatalf("did not expect error, got: %v", err)
+		}
+
+		expected := []string{
+			"start",
+			"height_start 3",
+			"height_complete true",
+			"finish <nil>",
+			"second finish",
+		}
+		if !reflect.DeepEqual(calls, expected) {
+			t.Errorf("exp: %v, got: %v", expected, calls)
+		}
+	})
+}
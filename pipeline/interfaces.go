@@ -31,6 +31,12 @@ type Source interface {
 	Skip(StageName) bool
 }
 
+// TaskSkipper can be implemented by sources which know that individual tasks can be skipped for the current height
+type TaskSkipper interface {
+	// SkipTask return bool to skip task in stage
+	SkipTask(StageName, string) bool
+}
+
 // Sink is executed as a last stage in the pipeline
 type Sink interface {
 	// Consume consumes payloadMock
@@ -46,6 +52,9 @@ type stageRunner interface {
 	Run(context.Context, Payload, TaskValidator) error
 }
 
+// StageRunner is an exported name of stageRunner, so stage runners can be wrapped with WrapStage
+type StageRunner = stageRunner
+
 // StageRunnerFunc is an adapter to allow the use of plain functions as stageRunner
 type StageRunnerFunc func(context.Context, Payload, TaskValidator) error
 
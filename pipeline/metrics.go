@@ -33,10 +33,33 @@ var (
 		Desc:      "The total number of successfully indexed heights",
 	})
 
+	heightsSkippedMetric = metrics.MustNewCounterWithTags(metrics.Options{
+		Namespace: "indexer",
+		Subsystem: "pipeline",
+		Name:      "heights_skipped_total",
+		Desc:      "The total number of heights skipped on purpose",
+	})
+
+	tasksSkippedMetric = metrics.MustNewCounterWithTags(metrics.Options{
+		Namespace: "indexer",
+		Subsystem: "pipeline",
+		Name:      "tasks_skipped_total",
+		Desc:      "The total number of tasks skipped by the source",
+		Tags:      []string{"stage", "task"},
+	})
+
 	errorsTotalMetric = metrics.MustNewCounterWithTags(metrics.Options{
 		Namespace: "indexer",
 		Subsystem: "pipeline",
 		Name:      "errors_total",
 		Desc:      "The total number of indexing errors",
 	})
+
+	eventsDroppedMetric = metrics.MustNewCounterWithTags(metrics.Options{
+		Namespace: "indexer",
+		Subsystem: "pipeline",
+		Name:      "events_dropped_total",
+		Desc:      "The total number of lifecycle events dropped because of slow subscribers",
+		Tags:      []string{"event"},
+	})
 )
@@ -8,6 +8,7 @@ import (
 
 	"github.com/hashicorp/go-multierror"
 
+	"github.com/figment-networks/indexing-engine/datalake"
 	"github.com/figment-networks/indexing-engine/metrics"
 )
 
@@ -44,8 +45,9 @@ const (
 )
 
 var (
-	ErrMissingStages = errors.New("provide stages to run concurrently")
-	ErrMissingStage  = errors.New("no stage to run")
+	ErrMissingStages     = errors.New("provide stages to run concurrently")
+	ErrMissingStage      = errors.New("no stage to run")
+	ErrInvalidStageIndex = errors.New("stage index out of range")
 )
 
 type StageName string
@@ -61,11 +63,30 @@ type Options struct {
 
 type Pipeline interface {
 	SetLogger(l Logger)
+	Validate() error
 	AddStageBefore(existingStageName StageName, stage *stage)
 	AddStageAfter(existingStageName StageName, stage *stage)
 	RetryStage(existingStageName StageName, isTransient func(error) bool, maxRetries int)
+	RemoveStage(existingStageName StageName)
+	ReplaceStage(existingStageName StageName, stage *stage)
+	InsertStageAt(index int, stage *stage)
+	WrapStage(existingStageName StageName, wrap func(StageRunner) StageRunner)
+	AlwaysRunStage(existingStageName StageName)
+	SetCheckpoint(storage datalake.Storage, codec PayloadCodec, stageNames ...StageName)
+	SetCheckpointNamespace(namespace string)
+	SetPayloadSnapshots(dl *datalake.DataLake, options SnapshotOptions)
+	SetWatchdog(options WatchdogOptions)
+	AddHooks(hooks Hooks)
 	Start(ctx context.Context, source Source, sink Sink, options *Options) error
 	Run(ctx context.Context, height int64, options *Options) (Payload, error)
+	RunRange(ctx context.Context, startHeight, endHeight int64, options *RangeOptions) ([]HeightResult, error)
+	Subscribe(bufferSize int) <-chan Event
+	Unsubscribe(ch <-chan Event)
+	Pause()
+	Resume()
+	Status() Status
+	SetStagesBlacklist(stages []StageName)
+	SetTaskWhitelist(tasks []TaskName)
 }
 
 // DefaultPipeline is implemented by types that only want to configure existing stages in a pipeline
@@ -119,12 +140,28 @@ func NewCustom(payloadFactor PayloadFactory) CustomPipeline {
 // pipeline implements a modular, multi-stage pipeline
 type pipeline struct {
 	payloadFactory PayloadFactory
-	options        *Options
 
 	stages [][]*stage
 
 	beforeStage map[StageName][]*stage
 	afterStage  map[StageName][]*stage
+
+	// alwaysRun holds names of stages executed even after an earlier stage fails
+	alwaysRun map[StageName]bool
+
+	checkpointer *checkpointer
+	// checkpointNamespace separates checkpoints of pipelines sharing a storage
+	checkpointNamespace string
+	snapshotter         *snapshotter
+	watchdog            *watchdog
+
+	hooks hooks
+
+	// configErrs holds configuration errors reported by Validate
+	configErrs []error
+
+	events  *eventBus
+	control *control
 }
 
 func new(payloadFactor PayloadFactory) *pipeline {
@@ -134,6 +171,11 @@ func new(payloadFactor PayloadFactory) *pipeline {
 
 		beforeStage: make(map[StageName][]*stage),
 		afterStage:  make(map[StageName][]*stage),
+
+		alwaysRun: map[StageName]bool{StageCleanup: true},
+
+		events:  newEventBus(),
+		control: newControl(),
 	}
 }
 
@@ -160,13 +202,14 @@ func (p *pipeline) SetCustomStage(stageName StageName, runner stageRunner) {
 func (p *pipeline) setRunnerForStage(stageName StageName, runner stageRunner) {
 	for _, stages := range p.stages {
 		for _, s := range stages {
-			if s.Name == stageName {
+			if s != nil && s.Name == stageName {
 				s.runner = runner
 				return
 			}
 		}
 	}
 	logInfo(fmt.Sprintf("cannot set stage runner for stage, stage '%v' not found on pipeline", stageName))
+	p.configErrs = append(p.configErrs, fmt.Errorf("%w: cannot set runner for %s", ErrUnknownStage, stageName))
 }
 
 // AddConcurrentStages adds stages that will run concurrently in the pipeline
@@ -192,21 +235,222 @@ func (p *pipeline) AddStageAfter(existingStageName StageName, s *stage) {
 	p.afterStage[existingStageName] = append(p.afterStage[existingStageName], s)
 }
 
-// RetryStage implements retry mechanism for entire stage
+// RetryStage implements retry mechanism for entire stage.
+// Errors are classified the same way as in RetryingTask, so isTransient can be nil.
 func (p *pipeline) RetryStage(existingStageName StageName, isTransient func(error) bool, maxRetries int) {
-	for _, stages := range p.stages {
+	p.WrapStage(existingStageName, func(runner StageRunner) StageRunner {
+		return retryingStageRunner(runner, isTransient, maxRetries)
+	})
+}
+
+// WrapStage replaces the runner of an existing stage with the runner returned by wrap.
+// It can be used to add behavior like retries or logging around a stage without replacing it.
+func (p *pipeline) WrapStage(existingStageName StageName, wrap func(StageRunner) StageRunner) {
+	found := p.updateStages(existingStageName, func(s *stage) *stage {
+		s.runner = wrap(s.runner)
+		return s
+	})
+	if !found {
+		p.configErrs = append(p.configErrs, fmt.Errorf("%w: cannot wrap %s", ErrUnknownStage, existingStageName))
+	}
+}
+
+// RemoveStage removes an existing stage from the pipeline.
+// Stages added before or after the removed stage are removed with it.
+func (p *pipeline) RemoveStage(existingStageName StageName) {
+	found := p.updateStages(existingStageName, func(*stage) *stage {
+		return nil
+	})
+	if !found {
+		p.configErrs = append(p.configErrs, fmt.Errorf("%w: cannot remove %s", ErrUnknownStage, existingStageName))
+		return
+	}
+
+	p.removeAnchored(existingStageName)
+}
+
+// removeAnchored removes stages added before or after the given stage, and stages anchored to them in turn
+func (p *pipeline) removeAnchored(anchor StageName) {
+	for _, anchored := range []map[StageName][]*stage{p.beforeStage, p.afterStage} {
+		stages, ok := anchored[anchor]
+		if !ok {
+			continue
+		}
+		delete(anchored, anchor)
+
+		for _, s := range stages {
+			if s != nil && s.Name != anchor {
+				p.removeAnchored(s.Name)
+			}
+		}
+	}
+}
+
+// ReplaceStage replaces an existing stage with a new one, keeping its position in the pipeline.
+// Stages added before or after the existing stage are moved to the new one.
+func (p *pipeline) ReplaceStage(existingStageName StageName, newStage *stage) {
+	found := p.updateStages(existingStageName, func(*stage) *stage {
+		return newStage
+	})
+	if !found {
+		p.configErrs = append(p.configErrs, fmt.Errorf("%w: cannot replace %s", ErrUnknownStage, existingStageName))
+		return
+	}
+
+	if newStage != nil && newStage.Name != existingStageName {
+		for _, anchored := range []map[StageName][]*stage{p.beforeStage, p.afterStage} {
+			if stages, ok := anchored[existingStageName]; ok {
+				anchored[newStage.Name] = append(anchored[newStage.Name], stages...)
+				delete(anchored, existingStageName)
+			}
+		}
+	}
+}
+
+// InsertStageAt inserts a stage at the given position in the pipeline run order.
+// Concurrent stages added with AddConcurrentStages take a single position.
+func (p *pipeline) InsertStageAt(index int, s *stage) {
+	if s == nil {
+		p.configErrs = append(p.configErrs, fmt.Errorf("cannot insert stage at position %d: %w", index, ErrMissingStage))
+		return
+	}
+	if index < 0 || index > len(p.stages) {
+		p.configErrs = append(p.configErrs, fmt.Errorf("cannot insert stage %s at position %d: %w", s.Name, index, ErrInvalidStageIndex))
+		return
+	}
+
+	p.stages = append(p.stages, nil)
+	copy(p.stages[index+1:], p.stages[index:])
+	p.stages[index] = []*stage{s}
+}
+
+// updateStages replaces every main, before and after stage with the given name by the result of update.
+// Stages for which update returns nil are removed. It reports whether any stage was found.
+func (p *pipeline) updateStages(stageName StageName, update func(*stage) *stage) bool {
+	var found bool
+	updateList := func(stages []*stage) []*stage {
+		updated := make([]*stage, 0, len(stages))
 		for _, s := range stages {
-			if s.Name == existingStageName {
-				s.runner = retryingStageRunner(s.runner, isTransient, maxRetries)
+			if s != nil && s.Name == stageName {
+				found = true
+				if s = update(s); s == nil {
+					continue
+				}
 			}
+			updated = append(updated, s)
 		}
+		return updated
 	}
+
+	groups := make([][]*stage, 0, len(p.stages))
+	for _, stages := range p.stages {
+		if stages = updateList(stages); len(stages) > 0 {
+			groups = append(groups, stages)
+		}
+	}
+	p.stages = groups
+
+	for _, anchored := range []map[StageName][]*stage{p.beforeStage, p.afterStage} {
+		for anchor, stages := range anchored {
+			anchored[anchor] = updateList(stages)
+		}
+	}
+
+	return found
+}
+
+// AlwaysRunStage marks the stage to run even when an earlier stage fails or the context is cancelled.
+// The failure cause is available to the stage through FailureCause. The cleanup stage is always run by default.
+func (p *pipeline) AlwaysRunStage(existingStageName StageName) {
+	p.alwaysRun[existingStageName] = true
+}
+
+// SetCheckpoint enables resuming of failed heights.
+// The payload is saved with the codec into the storage after any of the given stages completes.
+// When the same height is processed again, the payload is restored and
+// the pipeline resumes after the last completed stage, skipping all stages before it
+// except the setup stage and always-run stages.
+func (p *pipeline) SetCheckpoint(storage datalake.Storage, codec PayloadCodec, stageNames ...StageName) {
+	p.checkpointer = newCheckpointer(storage, codec, stageNames...)
+	p.checkpointer.namespace = p.checkpointNamespace
+}
+
+// SetCheckpointNamespace stores checkpoints under the namespace, so pipelines,
+// including sub-pipelines, can share a checkpoint storage without overwriting each other's checkpoints.
+func (p *pipeline) SetCheckpointNamespace(namespace string) {
+	p.checkpointNamespace = namespace
+	if p.checkpointer != nil {
+		p.checkpointer.namespace = namespace
+	}
+}
+
+// SetPayloadSnapshots enables debug snapshots of the payload.
+// The payload is serialized as JSON after the selected stages and stored in the data lake
+// at the processed height under the debug/<stage> name. Snapshots are taken even when the stage fails.
+func (p *pipeline) SetPayloadSnapshots(dl *datalake.DataLake, options SnapshotOptions) {
+	p.snapshotter = newSnapshotter(dl, options)
+}
+
+// SetWatchdog enables reporting of stages and tasks running longer than the thresholds.
+// Slow stages and tasks are logged with a goroutine dump, and task goroutines get pprof labels.
+func (p *pipeline) SetWatchdog(options WatchdogOptions) {
+	p.watchdog = &watchdog{options: options}
+}
+
+// AddHooks registers lifecycle callbacks invoked by Start, Run and RunRange.
+// Hooks are invoked in the order they were added.
+func (p *pipeline) AddHooks(hooks Hooks) {
+	p.hooks = append(p.hooks, hooks)
+}
+
+// Subscribe returns a channel receiving pipeline lifecycle events.
+// Events are dropped when the channel buffer is full, so a slow subscriber never blocks indexing.
+func (p *pipeline) Subscribe(bufferSize int) <-chan Event {
+	return p.events.subscribe(bufferSize)
+}
+
+// Unsubscribe stops delivering events to the given channel and closes it
+func (p *pipeline) Unsubscribe(ch <-chan Event) {
+	p.events.unsubscribe(ch)
+}
+
+// Pause stops the pipeline started with Start before it processes the next height
+func (p *pipeline) Pause() {
+	p.control.pause()
+}
+
+// Resume continues processing of heights after Pause
+func (p *pipeline) Resume() {
+	p.control.resume()
+}
+
+// Status returns the current status of the pipeline
+func (p *pipeline) Status() Status {
+	return p.control.snapshot()
+}
+
+// SetStagesBlacklist replaces the stages blacklist of the running pipeline starting with the next height
+func (p *pipeline) SetStagesBlacklist(stages []StageName) {
+	p.control.setStagesBlacklist(stages)
+}
+
+// SetTaskWhitelist replaces the task whitelist of the running pipeline starting with the next height
+func (p *pipeline) SetTaskWhitelist(tasks []TaskName) {
+	p.control.setTaskWhitelist(tasks)
 }
 
 // Start starts the pipeline
 func (p *pipeline) Start(ctx context.Context, source Source, sink Sink, options *Options) error {
+	if err := p.Validate(); err != nil {
+		return err
+	}
+
 	pCtx, _ := p.setupCtx(ctx)
-	p.options = options
+
+	p.control.setRunning(true)
+	defer p.control.setRunning(false)
+
+	p.hooks.start(ctx)
 
 	heightCounter := heightsTotalMetric.WithLabels()
 	durationObserver := heightDurationMetric.WithLabels()
@@ -214,18 +458,36 @@ func (p *pipeline) Start(ctx context.Context, source Source, sink Sink, options
 	var pipelineErr error
 	var recentPayload Payload
 	for ok := true; ok; ok = source.Next(ctx, recentPayload) {
-		payload := p.payloadFactory.GetPayload(source.Current())
+		// Pausing and option changes take effect only between heights
+		if err := p.control.waitIfPaused(ctx); err != nil {
+			pipelineErr = err
+			break
+		}
+		options = p.control.applyOptions(options)
+
+		height := source.Current()
+		payload := p.payloadFactory.GetPayload(height)
 
 		timer := metrics.NewTimer(durationObserver)
 
-		pipelineErr = p.runStages(pCtx, payload, source)
+		hCtx := withEventHeight(pCtx, p.events, height)
+		stat := p.heightStarted(height)
+
+		pipelineErr = p.runStages(hCtx, height, payload, source, options)
 		if pipelineErr != nil {
+			p.heightFinished(height, payload, stat, pipelineErr)
+			if IsSkipHeight(pipelineErr) {
+				logInfo(fmt.Sprintf("height %d skipped: %v", height, pipelineErr))
+				pipelineErr = nil
+				continue
+			}
 			// We don't want to run pipeline for rest of heights since we don't want to have gaps in records
 			break
 		}
 
 		if err := sink.Consume(pCtx, payload); err != nil {
 			pipelineErr = err
+			p.heightFinished(height, payload, stat, pipelineErr)
 			// Stop execution when sink errors out
 			break
 		}
@@ -235,6 +497,8 @@ func (p *pipeline) Start(ctx context.Context, source Source, sink Sink, options
 		timer.ObserveDuration()
 		heightCounter.Inc()
 
+		p.heightFinished(height, payload, stat, nil)
+
 		recentPayload = payload
 	}
 
@@ -246,23 +510,47 @@ func (p *pipeline) Start(ctx context.Context, source Source, sink Sink, options
 		errorsTotalMetric.WithLabels().Inc()
 	}
 
+	p.events.publish(Event{Type: EventPipelineStopped, Height: source.Current(), Err: pipelineErr})
+	p.hooks.finish(pipelineErr)
+
 	return pipelineErr
 }
 
-// Run run one-off pipeline iteration for given height
+// Run run one-off pipeline iteration for given height.
+// It is safe to call Run concurrently, options are only used by the given call.
 func (p *pipeline) Run(ctx context.Context, height int64, options *Options) (Payload, error) {
-	pCtx, _ := p.setupCtx(ctx)
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
 
-	p.options = options
+	p.hooks.start(ctx)
+
+	payload, _, err := p.runHeight(ctx, height, options)
+	p.hooks.finish(err)
+	if err != nil {
+		return nil, err
+	}
+	return payload, nil
+}
+
+// runHeight runs one-off pipeline iteration for given height and returns its stat
+func (p *pipeline) runHeight(ctx context.Context, height int64, options *Options) (Payload, *Stat, error) {
+	pCtx, _ := p.setupCtx(ctx)
 
 	payload := p.payloadFactory.GetPayload(height)
 
 	observer := heightDurationMetric.WithLabels()
 	timer := metrics.NewTimer(observer)
 
-	if err := p.runStages(pCtx, payload, NewSource()); err != nil {
-		errorsTotalMetric.WithLabels().Inc()
-		return nil, err
+	hCtx := withEventHeight(pCtx, p.events, height)
+	stat := p.heightStarted(height)
+
+	if err := p.runStages(hCtx, height, payload, NewSource(), options); err != nil {
+		if !IsSkipHeight(err) {
+			errorsTotalMetric.WithLabels().Inc()
+		}
+		p.heightFinished(height, payload, stat, err)
+		return payload, stat, err
 	}
 
 	payload.MarkAsProcessed()
@@ -270,7 +558,36 @@ func (p *pipeline) Run(ctx context.Context, height int64, options *Options) (Pay
 	timer.ObserveDuration()
 	heightsTotalMetric.WithLabels().Inc()
 
-	return payload, nil
+	p.heightFinished(height, payload, stat, nil)
+
+	return payload, stat, nil
+}
+
+// heightStarted records and announces the start of processing of a height
+func (p *pipeline) heightStarted(height int64) *Stat {
+	p.events.publish(Event{Type: EventHeightStarted, Height: height})
+	p.hooks.heightStart(height)
+	return p.control.heightStarted(height)
+}
+
+// heightFinished records and announces the result of processing of a height
+func (p *pipeline) heightFinished(height int64, payload Payload, stat *Stat, err error) {
+	p.control.heightFinished(height, stat, err)
+
+	if IsSkipHeight(err) {
+		heightsSkippedMetric.WithLabels().Inc()
+		p.events.publish(Event{Type: EventHeightSkipped, Height: height, Err: err})
+	} else if err != nil {
+		p.events.publish(Event{Type: EventHeightFailed, Height: height, Err: err})
+	} else {
+		p.events.publish(Event{Type: EventHeightCompleted, Height: height})
+	}
+
+	if err != nil {
+		p.hooks.heightError(height, err)
+	} else {
+		p.hooks.heightComplete(payload, stat)
+	}
 }
 
 // setupCtx sets up the context
@@ -285,27 +602,103 @@ func (p *pipeline) setupCtx(ctx context.Context) (context.Context, context.Cance
 	return pCtx, cancelFunc
 }
 
-// runStages runs all the stages
-func (p *pipeline) runStages(ctx context.Context, payload Payload, source Source) error {
-	for _, stages := range p.stages {
-		if len(stages) == 1 {
-			if err := p.runStage(ctx, stages[0], payload, source); err != nil {
-				return err
+// runStages runs all the stages.
+// Once a stage fails or the context is cancelled, only always-run stages are executed.
+// Their errors are combined with the original error.
+// When checkpoints are enabled, stages completed in a previous attempt are skipped.
+func (p *pipeline) runStages(ctx context.Context, height int64, payload Payload, source Source, options *Options) error {
+	ctx = withOptions(ctx, options)
+	if p.watchdog != nil {
+		ctx = withWatchdog(ctx, p.watchdog)
+	}
+	if skipper, ok := source.(TaskSkipper); ok {
+		ctx = context.WithValue(ctx, ctxTaskSkipper, skipper)
+	}
+
+	resumeIndex := p.resumeIndex(height, payload)
+	checkpointed := resumeIndex > 0
+
+	var runErr error
+	for i, stages := range p.stages {
+		resumed := i < resumeIndex
+		if resumed {
+			// Setup and always-run stages are run again, so they stay paired with cleanup
+			stages = p.resumedStages(stages)
+			if len(stages) == 0 {
+				continue
+			}
+		}
+
+		if runErr == nil {
+			runErr = ctx.Err()
+		}
+
+		if runErr != nil {
+			alwaysRunStages := p.alwaysRunStages(stages)
+			if len(alwaysRunStages) == 0 {
+				continue
 			}
-		} else if len(stages) > 1 {
-			if err := p.runStagesConcurrently(ctx, payload, stages, source); err != nil {
-				return err
+			if err := p.runStageGroup(withFailureCause(ctx, runErr), payload, alwaysRunStages, source, options); err != nil {
+				runErr = multierror.Append(runErr, err)
 			}
-		} else {
-			logInfo("no stages to run")
+			if p.snapshotter != nil {
+				p.snapshotStages(ctx, height, alwaysRunStages, payload)
+			}
+			continue
+		}
+
+		runErr = p.runStageGroup(ctx, payload, stages, source, options)
+		if p.snapshotter != nil {
+			p.snapshotStages(ctx, height, stages, payload)
+		}
+		if runErr == nil && p.checkpointer != nil && !resumed {
+			checkpointed = p.saveCheckpoint(height, stages, payload) || checkpointed
 		}
 	}
 
+	if runErr == nil && checkpointed {
+		p.clearCheckpoint(height)
+	}
+
+	return runErr
+}
+
+// runStageGroup runs a single stage or a group of concurrent stages
+func (p *pipeline) runStageGroup(ctx context.Context, payload Payload, stages []*stage, source Source, options *Options) error {
+	if len(stages) == 1 {
+		return p.runStage(ctx, stages[0], payload, source, options)
+	} else if len(stages) > 1 {
+		return p.runStagesConcurrently(ctx, payload, stages, source, options)
+	}
+
+	logInfo("no stages to run")
 	return nil
 }
 
+// alwaysRunStages filters stages marked as always-run
+func (p *pipeline) alwaysRunStages(stages []*stage) []*stage {
+	var filtered []*stage
+	for _, s := range stages {
+		if s != nil && p.alwaysRun[s.Name] {
+			filtered = append(filtered, s)
+		}
+	}
+	return filtered
+}
+
+// resumedStages filters the setup and always-run stages, which run even when they're before the resume point
+func (p *pipeline) resumedStages(stages []*stage) []*stage {
+	var filtered []*stage
+	for _, s := range stages {
+		if s != nil && (s.Name == StageSetup || p.alwaysRun[s.Name]) {
+			filtered = append(filtered, s)
+		}
+	}
+	return filtered
+}
+
 // runStagesConcurrently runs indexing stages concurrently
-func (p *pipeline) runStagesConcurrently(ctx context.Context, payload Payload, stages []*stage, source Source) error {
+func (p *pipeline) runStagesConcurrently(ctx context.Context, payload Payload, stages []*stage, source Source, options *Options) error {
 	stagesCount := len(stages)
 	if stagesCount == 0 {
 		return ErrMissingStages
@@ -318,7 +711,7 @@ func (p *pipeline) runStagesConcurrently(ctx context.Context, payload Payload, s
 
 	for _, s := range stages {
 		go func(stage *stage) {
-			if err := p.runStage(ctx, stage, payload, source); err != nil {
+			if err := p.runStage(ctx, stage, payload, source, options); err != nil {
 				errCh <- err
 			}
 			wg.Done()
@@ -337,29 +730,29 @@ func (p *pipeline) runStagesConcurrently(ctx context.Context, payload Payload, s
 }
 
 // runStage executes stage runner for given stage
-func (p *pipeline) runStage(ctx context.Context, stage *stage, payload Payload, source Source) error {
+func (p *pipeline) runStage(ctx context.Context, stage *stage, payload Payload, source Source, options *Options) error {
 	if stage == nil {
 		return ErrMissingStage
 	}
 
-	if p.canRunStage(stage.Name, source) {
+	if p.canRunStage(stage.Name, source, options) {
 		before := p.beforeStage[stage.Name]
 		if len(before) > 0 {
 			for _, s := range before {
-				if err := s.Run(ctx, payload, p.options); err != nil {
+				if err := p.execStage(ctx, s, payload, options); err != nil {
 					return err
 				}
 			}
 		}
 
-		if err := stage.Run(ctx, payload, p.options); err != nil {
+		if err := p.execStage(ctx, stage, payload, options); err != nil {
 			return err
 		}
 
 		after := p.afterStage[stage.Name]
 		if len(after) > 0 {
 			for _, s := range after {
-				if err := s.Run(ctx, payload, p.options); err != nil {
+				if err := p.execStage(ctx, s, payload, options); err != nil {
 					return err
 				}
 			}
@@ -368,10 +761,31 @@ func (p *pipeline) runStage(ctx context.Context, stage *stage, payload Payload,
 	return nil
 }
 
+// execStage runs a single stage and publishes its start and finish events
+func (p *pipeline) execStage(ctx context.Context, s *stage, payload Payload, options *Options) error {
+	name := stagePath(ctx, s.Name)
+	ctx = withEventStage(ctx, name)
+
+	stat := NewStat()
+	publishEvent(ctx, Event{Type: EventStageStarted})
+
+	stopWatching := watchStage(ctx)
+	err := s.Run(ctx, payload, options)
+	stopWatching()
+
+	stat.SetCompleted(err == nil)
+	if recorder, ok := ctx.Value(CtxStats).(*StatsRecorder); ok {
+		recorder.RecordStage(name, *stat)
+	}
+	publishEvent(ctx, Event{Type: EventStageFinished, Err: err})
+
+	return err
+}
+
 // canRunStage determines if stage can be ran
-func (p *pipeline) canRunStage(stageName StageName, source Source) bool {
-	if p.options != nil && len(p.options.StagesBlacklist) > 0 {
-		for _, s := range p.options.StagesBlacklist {
+func (p *pipeline) canRunStage(stageName StageName, source Source, options *Options) bool {
+	if options != nil && len(options.StagesBlacklist) > 0 {
+		for _, s := range options.StagesBlacklist {
 			if s == stageName {
 				return false
 			}
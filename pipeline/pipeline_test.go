@@ -3,7 +3,10 @@ package pipeline_test
 import (
 	"context"
 	"errors"
+	"fmt"
 	"math/rand"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -285,8 +288,13 @@ func TestPipeline_Start(t *testing.T) {
 				mockTask := mock.NewMockTask(ctrl)
 
 				if !shouldRun {
-					mockTask.EXPECT().GetName().Return("mockTask").Times(0)
-					mockTask.EXPECT().Run(gomock.Any(), gomock.Any()).Return(nil).Times(0)
+					// Cleanup stage runs even after an earlier stage fails
+					var calls int
+					if stage == pipeline.StageCleanup {
+						calls = 1
+					}
+					mockTask.EXPECT().GetName().Return("mockTask").Times(calls * 2)
+					mockTask.EXPECT().Run(gomock.Any(), gomock.Any()).Return(nil).Times(calls)
 					p.SetTasks(stage, mockTask)
 					continue
 				}
@@ -332,8 +340,8 @@ func TestPipeline_Start(t *testing.T) {
 		p.SetTasks(pipeline.StageSequencer, sequencerTask)
 
 		cleanupTask := mock.NewMockTask(ctrl)
-		cleanupTask.EXPECT().GetName().Return("cleanupTask").Times(0)
-		cleanupTask.EXPECT().Run(gomock.Any(), gomock.Any()).Return(nil).Times(0)
+		cleanupTask.EXPECT().GetName().Return("cleanupTask").Times(2)
+		cleanupTask.EXPECT().Run(gomock.Any(), gomock.Any()).Return(nil).Times(1)
 		p.SetTasks(pipeline.StageCleanup, cleanupTask)
 
 		sinkMock := mock.NewMockSink(ctrl)
@@ -588,6 +596,49 @@ func TestPipeline_StagesBlacklist(t *testing.T) {
 	})
 }
 
+type taskSkippingSourceMock struct {
+	sourceMock
+	skippedTask string
+}
+
+func (s *taskSkippingSourceMock) SkipTask(stageName pipeline.StageName, taskName string) bool {
+	return stageName == pipeline.StageParser && taskName == s.skippedTask
+}
+
+func TestPipeline_TaskSkipper(t *testing.T) {
+	t.Run("task skipped by source should not run", func(t *testing.T) {
+		ctrl, ctx := gomock.WithContext(context.Background(), t)
+		defer ctrl.Finish()
+
+		payloadFactoryMock := mock.NewMockPayloadFactory(ctrl)
+		payloadFactoryMock.EXPECT().GetPayload(gomock.Any()).Return(&payloadMock{}).Times(2)
+
+		p := pipeline.NewCustom(payloadFactoryMock)
+
+		fetcherTask := mock.NewMockTask(ctrl)
+		fetcherTask.EXPECT().GetName().Return("TxTask").Times(4)
+		fetcherTask.EXPECT().Run(gomock.Any(), gomock.Any()).Return(nil).Times(2)
+		p.AddStage(pipeline.NewStageWithTasks(pipeline.StageFetcher, fetcherTask))
+
+		txTask := mock.NewMockTask(ctrl)
+		txTask.EXPECT().GetName().Return("TxTask").Times(2)
+		txTask.EXPECT().Run(gomock.Any(), gomock.Any()).Times(0)
+
+		blockTask := mock.NewMockTask(ctrl)
+		blockTask.EXPECT().GetName().Return("BlockTask").Times(4)
+		blockTask.EXPECT().Run(gomock.Any(), gomock.Any()).Return(nil).Times(2)
+		p.AddStage(pipeline.NewAsyncStageWithTasks(pipeline.StageParser, txTask, blockTask))
+
+		sinkMock := mock.NewMockSink(ctrl)
+		sinkMock.EXPECT().Consume(gomock.Any(), gomock.Any()).Return(nil).Times(2)
+
+		source := &taskSkippingSourceMock{sourceMock{1, 2, 1, false}, "TxTask"}
+		if err := p.Start(ctx, source, sinkMock, nil); err != nil {
+			t.Errorf("should not return error")
+		}
+	})
+}
+
 func TestPipeline_RetryStage(t *testing.T) {
 	t.Run("tasks return success", func(t *testing.T) {
 		ctrl, ctx := gomock.WithContext(context.Background(), t)
@@ -666,3 +717,331 @@ func TestPipeline_RetryStage(t *testing.T) {
 		}
 	})
 }
+
+func TestPipeline_AlwaysRunStage(t *testing.T) {
+	t.Run("cleanup stage receives failure cause", func(t *testing.T) {
+		ctrl, ctx := gomock.WithContext(context.Background(), t)
+		defer ctrl.Finish()
+
+		stageErr := errors.New("err")
+
+		payloadFactoryMock := mock.NewMockPayloadFactory(ctrl)
+		payloadFactoryMock.EXPECT().GetPayload(gomock.Any()).Return(&payloadMock{}).Times(1)
+
+		p := pipeline.NewDefault(payloadFactoryMock)
+
+		fetcherTask := mock.NewMockTask(ctrl)
+		fetcherTask.EXPECT().GetName().Return("fetcherTask").Times(2)
+		fetcherTask.EXPECT().Run(gomock.Any(), gomock.Any()).Return(stageErr).Times(1)
+		p.SetTasks(pipeline.StageFetcher, fetcherTask)
+
+		var cause error
+		p.SetCustomStage(pipeline.StageCleanup, pipeline.StageRunnerFunc(func(ctx context.Context, _ pipeline.Payload, _ pipeline.TaskValidator) error {
+			cause = pipeline.FailureCause(ctx)
+			return nil
+		}))
+
+		if _, err := p.Run(ctx, 1, nil); err != stageErr {
+			t.Errorf("exp: %v, got: %v", stageErr, err)
+		}
+		if cause != stageErr {
+			t.Errorf("expected cleanup stage to receive failure cause, got: %v", cause)
+		}
+	})
+
+	t.Run("always-run stage errors are combined with original error", func(t *testing.T) {
+		ctrl, ctx := gomock.WithContext(context.Background(), t)
+		defer ctrl.Finish()
+
+		stageErr := errors.New("stage err")
+		alwaysRunErr := errors.New("always run err")
+
+		payloadFactoryMock := mock.NewMockPayloadFactory(ctrl)
+		payloadFactoryMock.EXPECT().GetPayload(gomock.Any()).Return(&payloadMock{}).Times(1)
+
+		p := pipeline.NewCustom(payloadFactoryMock)
+
+		for _, s := range []struct {
+			name pipeline.StageName
+			err  error
+			runs int
+		}{
+			{pipeline.StageFetcher, stageErr, 1},
+			{pipeline.StageParser, nil, 0},
+			{"unlock", alwaysRunErr, 1},
+		} {
+			task := mock.NewMockTask(ctrl)
+			task.EXPECT().GetName().Return("task").Times(s.runs * 2)
+			task.EXPECT().Run(gomock.Any(), gomock.Any()).Return(s.err).Times(s.runs)
+			p.AddStage(pipeline.NewStageWithTasks(s.name, task))
+		}
+		p.AlwaysRunStage("unlock")
+
+		_, err := p.Run(ctx, 1, nil)
+		if !errors.Is(err, stageErr) || !errors.Is(err, alwaysRunErr) {
+			t.Errorf("expected combined error, got: %v", err)
+		}
+	})
+
+	t.Run("cleanup stage runs after context is cancelled", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		payloadFactoryMock := mock.NewMockPayloadFactory(ctrl)
+		payloadFactoryMock.EXPECT().GetPayload(gomock.Any()).Return(&payloadMock{}).Times(1)
+
+		p := pipeline.NewDefault(payloadFactoryMock)
+
+		fetcherTask := mock.NewMockTask(ctrl)
+		fetcherTask.EXPECT().GetName().Times(0)
+		p.SetTasks(pipeline.StageFetcher, fetcherTask)
+
+		var cleanupCtxErr, cause error
+		p.SetCustomStage(pipeline.StageCleanup, pipeline.StageRunnerFunc(func(ctx context.Context, _ pipeline.Payload, _ pipeline.TaskValidator) error {
+			cleanupCtxErr = ctx.Err()
+			cause = pipeline.FailureCause(ctx)
+			return nil
+		}))
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		if _, err := p.Run(ctx, 1, nil); err != context.Canceled {
+			t.Errorf("exp: %v, got: %v", context.Canceled, err)
+		}
+		if cause != context.Canceled || cleanupCtxErr != nil {
+			t.Errorf("expected cleanup to run with live context, got cause: %v, ctx err: %v", cause, cleanupCtxErr)
+		}
+	})
+}
+
+type countingTask struct {
+	name string
+	runs map[int64]*int32
+}
+
+func (t *countingTask) GetName() string {
+	return t.name
+}
+
+func (t *countingTask) Run(ctx context.Context, p pipeline.Payload) error {
+	atomic.AddInt32(t.runs[p.(*heightPayload).height], 1)
+	return nil
+}
+
+type heightPayload struct {
+	height int64
+}
+
+func (p *heightPayload) MarkAsProcessed() {}
+
+type heightPayloadFactory struct{}
+
+func (heightPayloadFactory) GetPayload(height int64) pipeline.Payload {
+	return &heightPayload{height: height}
+}
+
+func TestPipeline_RunConcurrently(t *testing.T) {
+	t.Run("concurrent runs use their own options", func(t *testing.T) {
+		const heights = 50
+
+		taskNames := []string{"taskA", "taskB", "taskC"}
+		tasks := make([]*countingTask, len(taskNames))
+		for i, name := range taskNames {
+			tasks[i] = &countingTask{name: name, runs: make(map[int64]*int32, heights)}
+			for h := int64(0); h < heights; h++ {
+				tasks[i].runs[h] = new(int32)
+			}
+		}
+
+		p := pipeline.NewCustom(heightPayloadFactory{})
+		p.AddStage(pipeline.NewAsyncStageWithTasks(pipeline.StageFetcher, tasks[0], tasks[1]))
+		p.AddStage(pipeline.NewStageWithTasks(pipeline.StageParser, tasks[2]))
+
+		var wg sync.WaitGroup
+		errs := make(chan error, heights)
+
+		for h := int64(0); h < heights; h++ {
+			wg.Add(1)
+			go func(height int64) {
+				defer wg.Done()
+
+				// Every height runs only one of the tasks
+				options := &pipeline.Options{
+					TaskWhitelist: []pipeline.TaskName{pipeline.TaskName(taskNames[height%int64(len(taskNames))])},
+				}
+
+				payload, err := p.Run(context.Background(), height, options)
+				if err != nil {
+					errs <- err
+					return
+				}
+				if payload.(*heightPayload).height != height {
+					errs <- fmt.Errorf("exp height: %d, got: %d", height, payload.(*heightPayload).height)
+				}
+			}(h)
+		}
+
+		wg.Wait()
+		close(errs)
+
+		for err := range errs {
+			t.Errorf("did not expect error, got: %v", err)
+		}
+
+		for h := int64(0); h < heights; h++ {
+			for i, task := range tasks {
+				var exp int32
+				if int64(i) == h%int64(len(taskNames)) {
+					exp = 1
+				}
+				if got := atomic.LoadInt32(task.runs[h]); got != exp {
+					t.Errorf("height %d, task %s exp runs: %d, got: %d", h, task.name, exp, got)
+				}
+			}
+		}
+	})
+}
+
+func TestPipeline_EditStages(t *testing.T) {
+	recordingRunner := func(name string, calls *[]string) pipeline.StageRunnerFunc {
+		return func(context.Context, pipeline.Payload, pipeline.TaskValidator) error {
+			*calls = append(*calls, name)
+			return nil
+		}
+	}
+
+	newPipeline := func(calls *[]string) pipeline.CustomPipeline {
+		p := pipeline.NewCustom(heightPayloadFactory{})
+		p.AddStage(pipeline.NewCustomStage(pipeline.StageFetcher, recordingRunner("fetcher", calls)))
+		p.AddStage(pipeline.NewCustomStage(pipeline.StageParser, recordingRunner("parser", calls)))
+		p.AddStageAfter(pipeline.StageParser, pipeline.NewCustomStage("afterParser", recordingRunner("afterParser", calls)))
+		p.AddStage(pipeline.NewCustomStage(pipeline.StagePersistor, recordingRunner("persistor", calls)))
+		return p
+	}
+
+	tests := []struct {
+		description string
+		edit        func(p pipeline.CustomPipeline, calls *[]string)
+		expCalls    []string
+	}{
+		{
+			description: "RemoveStage removes main stage",
+			edit: func(p pipeline.CustomPipeline, _ *[]string) {
+				p.RemoveStage(pipeline.StageFetcher)
+			},
+			expCalls: []string{"parser", "afterParser", "persistor"},
+		},
+		{
+			description: "RemoveStage removes stages anchored to removed stage",
+			edit: func(p pipeline.CustomPipeline, _ *[]string) {
+				p.RemoveStage(pipeline.StageParser)
+			},
+			expCalls: []string{"fetcher", "persistor"},
+		},
+		{
+			description: "RemoveStage removes after stage",
+			edit: func(p pipeline.CustomPipeline, _ *[]string) {
+				p.RemoveStage("afterParser")
+			},
+			expCalls: []string{"fetcher", "parser", "persistor"},
+		},
+		{
+			description: "ReplaceStage keeps position and anchored stages",
+			edit: func(p pipeline.CustomPipeline, calls *[]string) {
+				p.ReplaceStage(pipeline.StageParser, pipeline.NewCustomStage("customParser", recordingRunner("customParser", calls)))
+			},
+			expCalls: []string{"fetcher", "customParser", "afterParser", "persistor"},
+		},
+		{
+			description: "InsertStageAt inserts stage at position",
+			edit: func(p pipeline.CustomPipeline, calls *[]string) {
+				p.InsertStageAt(0, pipeline.NewCustomStage(pipeline.StageSetup, recordingRunner("setup", calls)))
+				p.InsertStageAt(3, pipeline.NewCustomStage(pipeline.StageValidator, recordingRunner("validator", calls)))
+			},
+			expCalls: []string{"setup", "fetcher", "parser", "afterParser", "validator", "persistor"},
+		},
+		{
+			description: "WrapStage wraps stage runner",
+			edit: func(p pipeline.CustomPipeline, calls *[]string) {
+				p.WrapStage(pipeline.StageParser, func(runner pipeline.StageRunner) pipeline.StageRunner {
+					return pipeline.StageRunnerFunc(func(ctx context.Context, payload pipeline.Payload, f pipeline.TaskValidator) error {
+						*calls = append(*calls, "beforeWrapped")
+						return runner.Run(ctx, payload, f)
+					})
+				})
+			},
+			expCalls: []string{"fetcher", "beforeWrapped", "parser", "afterParser", "persistor"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.description, func(t *testing.T) {
+			var calls []string
+			p := newPipeline(&calls)
+
+			tt.edit(p, &calls)
+
+			if _, err := p.Run(context.Background(), 1, nil); err != nil {
+				t.Fatalf("did not expect error, got: %v", err)
+			}
+
+			if fmt.Sprint(calls) != fmt.Sprint(tt.expCalls) {
+				t.Errorf("exp: %v, got: %v", tt.expCalls, calls)
+			}
+		})
+	}
+
+	t.Run("editing unknown stage fails validation", func(t *testing.T) {
+		for _, edit := range []func(p pipeline.CustomPipeline){
+			func(p pipeline.CustomPipeline) { p.RemoveStage("unknown") },
+			func(p pipeline.CustomPipeline) { p.ReplaceStage("unknown", pipeline.NewStageWithTasks("new")) },
+			func(p pipeline.CustomPipeline) {
+				p.WrapStage("unknown", func(r pipeline.StageRunner) pipeline.StageRunner { return r })
+			},
+		} {
+			var calls []string
+			p := newPipeline(&calls)
+
+			edit(p)
+
+			if err := p.Validate(); !errors.Is(err, pipeline.ErrUnknownStage) {
+				t.Errorf("exp: %v, got: %v", pipeline.ErrUnknownStage, err)
+			}
+		}
+	})
+
+	t.Run("removing anchor stage passes validation", func(t *testing.T) {
+		var calls []string
+		p := newPipeline(&calls)
+		p.AddStageBefore("afterParser", pipeline.NewCustomStage("beforeAfterParser", recordingRunner("beforeAfterParser", &calls)))
+
+		p.RemoveStage(pipeline.StageParser)
+
+		if err := p.Validate(); err != nil {
+			t.Errorf("did not expect error, got: %v", err)
+		}
+	})
+
+	t.Run("inserting nil stage fails validation", func(t *testing.T) {
+		var calls []string
+		p := newPipeline(&calls)
+
+		p.InsertStageAt(0, nil)
+
+		if err := p.Validate(); !errors.Is(err, pipeline.ErrMissingStage) {
+			t.Errorf("exp: %v, got: %v", pipeline.ErrMissingStage, err)
+		}
+	})
+
+	t.Run("inserting stage out of range fails validation", func(t *testing.T) {
+		var calls []string
+		p := newPipeline(&calls)
+
+		p.InsertStageAt(4, pipeline.NewStageWithTasks("new"))
+
+		if err := p.Validate(); !errors.Is(err, pipeline.ErrInvalidStageIndex) {
+			t.Errorf("exp: %v, got: %v", pipeline.ErrInvalidStageIndex, err)
+		}
+	})
+}
@@ -0,0 +1,98 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/hashicorp/go-multierror"
+)
+
+// ErrInvalidRange is returned when the start height of a range is greater than its end height
+var ErrInvalidRange = errors.New("start height is greater than end height")
+
+// RangeOptions holds options for RunRange
+type RangeOptions struct {
+	Options
+
+	// Parallelism is the number of heights processed at the same time. Heights are processed one by one by default.
+	Parallelism int
+}
+
+// HeightResult represents the outcome of processing a single height by RunRange
+type HeightResult struct {
+	Height int64
+
+	// Payload holds the payload of the height, also when processing failed
+	Payload Payload
+
+	// Err is the error returned while processing the height, if any
+	Err error
+
+	// Stat holds timing of the height. It is nil for heights not processed because the context was done.
+	Stat *Stat
+}
+
+// RunRange runs one-off pipeline iterations for all heights in the closed range [startHeight, endHeight].
+// Unlike Start, it does not stop on the first error but returns a result for every height, ordered by height.
+func (p *pipeline) RunRange(ctx context.Context, startHeight, endHeight int64, options *RangeOptions) ([]HeightResult, error) {
+	if startHeight > endHeight {
+		return nil, ErrInvalidRange
+	}
+
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+
+	var heightOptions *Options
+	parallelism := 1
+	if options != nil {
+		heightOptions = &options.Options
+		if options.Parallelism > 1 {
+			parallelism = options.Parallelism
+		}
+	}
+
+	p.hooks.start(ctx)
+
+	results := make([]HeightResult, endHeight-startHeight+1)
+	heights := make(chan int64)
+
+	var wg sync.WaitGroup
+	wg.Add(parallelism)
+
+	for i := 0; i < parallelism; i++ {
+		go func() {
+			defer wg.Done()
+
+			for height := range heights {
+				result := &results[height-startHeight]
+				result.Height = height
+
+				if err := ctx.Err(); err != nil {
+					result.Err = err
+					continue
+				}
+
+				result.Payload, result.Stat, result.Err = p.runHeight(ctx, height, heightOptions)
+			}
+		}()
+	}
+
+	for height := startHeight; height <= endHeight; height++ {
+		heights <- height
+	}
+	close(heights)
+
+	wg.Wait()
+
+	var errs error
+	for _, result := range results {
+		if result.Err != nil {
+			errs = multierror.Append(errs, result.Err)
+		}
+	}
+	p.hooks.finish(errs)
+
+	return results, nil
+}
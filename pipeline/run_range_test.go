@@ -0,0 +1,86 @@
+package pipeline_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/figment-networks/indexing-engine/pipeline"
+)
+
+func TestPipeline_RunRange(t *testing.T) {
+	evenErr := errors.New("even height")
+
+	newPipeline := func() pipeline.CustomPipeline {
+		p := pipeline.NewCustom(heightPayloadFactory{})
+		p.AddStage(pipeline.NewCustomStage(pipeline.StageFetcher, pipeline.StageRunnerFunc(
+			func(_ context.Context, payload pipeline.Payload, _ pipeline.TaskValidator) error {
+				if payload.(*heightPayload).height%2 == 0 {
+					return evenErr
+				}
+				return nil
+			})))
+		return p
+	}
+
+	for _, parallelism := range []int{0, 1, 4} {
+		t.Run(fmt.Sprintf("returns result for every height with parallelism %d", parallelism), func(t *testing.T) {
+			p := newPipeline()
+
+			results, err := p.RunRange(context.Background(), 10, 19, &pipeline.RangeOptions{Parallelism: parallelism})
+			if err != nil {
+				t.Fatalf("did not expect error, got: %v", err)
+			}
+
+			if len(results) != 10 {
+				t.Fatalf("exp: 10 results, got: %d", len(results))
+			}
+
+			for i, res := range results {
+				height := int64(10 + i)
+				if res.Height != height {
+					t.Errorf("exp height: %d, got: %d", height, res.Height)
+				}
+				if res.Payload == nil || res.Payload.(*heightPayload).height != height {
+					t.Errorf("expected payload for height %d", height)
+				}
+				if res.Stat == nil || res.Stat.Success != (res.Err == nil) {
+					t.Errorf("unexpected stat for height %d: %+v", height, res.Stat)
+				}
+				if height%2 == 0 && res.Err != evenErr {
+					t.Errorf("exp error for height %d, got: %v", height, res.Err)
+				}
+				if height%2 == 1 && res.Err != nil {
+					t.Errorf("did not expect error for height %d, got: %v", height, res.Err)
+				}
+			}
+		})
+	}
+
+	t.Run("returns error for invalid range", func(t *testing.T) {
+		p := newPipeline()
+
+		if _, err := p.RunRange(context.Background(), 2, 1, nil); err != pipeline.ErrInvalidRange {
+			t.Errorf("exp: %v, got: %v", pipeline.ErrInvalidRange, err)
+		}
+	})
+
+	t.Run("does not process heights after context is done", func(t *testing.T) {
+		p := newPipeline()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		results, err := p.RunRange(ctx, 1, 3, nil)
+		if err != nil {
+			t.Fatalf("did not expect error, got: %v", err)
+		}
+
+		for _, res := range results {
+			if res.Err != context.Canceled || res.Payload != nil || res.Stat != nil {
+				t.Errorf("unexpected result: %+v", res)
+			}
+		}
+	})
+}
@@ -0,0 +1,146 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+)
+
+var (
+	_ Source      = (*ShardedSource)(nil)
+	_ TaskSkipper = (*ShardedSource)(nil)
+
+	// ErrInvalidShard is returned when the shard index, count or strategy is invalid
+	ErrInvalidShard = errors.New("shard is invalid")
+)
+
+// ShardStrategy determines how heights are split between shards
+type ShardStrategy int
+
+const (
+	// ShardModulo assigns to the shard every height for which height % count == index.
+	// Heights are assigned the same way regardless of the height range.
+	ShardModulo ShardStrategy = iota
+
+	// ShardContiguous splits the height range into count contiguous blocks of about the same size
+	// and assigns the block with the index to the shard
+	ShardContiguous
+)
+
+// Shard identifies the part of heights processed by a single indexer instance
+type Shard struct {
+	// Index is the zero-based index of the shard
+	Index int64
+
+	// Count is the total number of shards
+	Count int64
+
+	// Strategy is the strategy used to split heights between shards
+	Strategy ShardStrategy
+}
+
+// Validate checks if the shard is valid
+func (s Shard) Validate() error {
+	if s.Count <= 0 || s.Index < 0 || s.Index >= s.Count {
+		return ErrInvalidShard
+	}
+
+	if s.Strategy != ShardModulo && s.Strategy != ShardContiguous {
+		return ErrInvalidShard
+	}
+
+	return nil
+}
+
+// ShardedSource wraps a source iterating over a height range, so it only yields heights assigned to the shard.
+// It allows multiple indexer instances to split the same height range without coordination.
+type ShardedSource struct {
+	source Source
+	shard  Shard
+
+	// startHeight and endHeight are the bounds of heights assigned to the shard
+	startHeight int64
+	endHeight   int64
+}
+
+// NewShardedSource creates a sharded source. The source is expected to start at heightRange.StartHeight()
+// and to move through consecutive heights up to heightRange.EndHeight().
+// The source is advanced to the first height of the shard, ErrNothingToProcess is returned if there is none.
+func NewShardedSource(ctx context.Context, source Source, heightRange HeightRange, shard Shard) (*ShardedSource, error) {
+	if err := shard.Validate(); err != nil {
+		return nil, err
+	}
+
+	s := &ShardedSource{
+		source:      source,
+		shard:       shard,
+		startHeight: heightRange.StartHeight(),
+		endHeight:   heightRange.EndHeight(),
+	}
+
+	if shard.Strategy == ShardContiguous {
+		blockSize := (heightRange.Length() + shard.Count - 1) / shard.Count
+
+		s.startHeight = heightRange.StartHeight() + shard.Index*blockSize
+		if end := s.startHeight + blockSize - 1; end < s.endHeight {
+			s.endHeight = end
+		}
+	}
+
+	if s.startHeight > s.endHeight {
+		return nil, ErrNothingToProcess
+	}
+
+	for !s.owns(source.Current()) {
+		if source.Current() >= s.endHeight || !source.Next(ctx, nil) {
+			if err := source.Err(); err != nil {
+				return nil, err
+			}
+			return nil, ErrNothingToProcess
+		}
+	}
+
+	return s, nil
+}
+
+// Next moves the underlying source to the next height of the shard
+func (s *ShardedSource) Next(ctx context.Context, p Payload) bool {
+	for s.source.Current() < s.endHeight && s.source.Next(ctx, p) {
+		if s.owns(s.source.Current()) {
+			return true
+		}
+	}
+	return false
+}
+
+// Current returns current height
+func (s *ShardedSource) Current() int64 {
+	return s.source.Current()
+}
+
+// Err returns the error of the underlying source
+func (s *ShardedSource) Err() error {
+	return s.source.Err()
+}
+
+// Skip delegates to the underlying source
+func (s *ShardedSource) Skip(stageName StageName) bool {
+	return s.source.Skip(stageName)
+}
+
+// SkipTask delegates to the underlying source if it implements TaskSkipper
+func (s *ShardedSource) SkipTask(stageName StageName, taskName string) bool {
+	skipper, ok := s.source.(TaskSkipper)
+	return ok && skipper.SkipTask(stageName, taskName)
+}
+
+// owns checks if the height is assigned to the shard
+func (s *ShardedSource) owns(height int64) bool {
+	if height < s.startHeight || height > s.endHeight {
+		return false
+	}
+
+	if s.shard.Strategy == ShardModulo {
+		return height%s.shard.Count == s.shard.Index
+	}
+	return true
+}
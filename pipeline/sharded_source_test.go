@@ -0,0 +1,56 @@
+package pipeline_test
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/figment-networks/indexing-engine/pipeline"
+)
+
+func TestShardedSource(t *testing.T) {
+	heightRange := pipeline.HeightRange{
+		LatestHeight:  10,
+		LastHeight:    0,
+		InitialHeight: 1,
+	}
+
+	tests := []struct {
+		shard   pipeline.Shard
+		heights []int64
+		err     error
+	}{
+		{pipeline.Shard{Index: 0, Count: 3, Strategy: pipeline.ShardModulo}, []int64{3, 6, 9}, nil},
+		{pipeline.Shard{Index: 1, Count: 3, Strategy: pipeline.ShardModulo}, []int64{1, 4, 7, 10}, nil},
+		{pipeline.Shard{Index: 0, Count: 1, Strategy: pipeline.ShardModulo}, []int64{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}, nil},
+		{pipeline.Shard{Index: 0, Count: 3, Strategy: pipeline.ShardContiguous}, []int64{1, 2, 3, 4}, nil},
+		{pipeline.Shard{Index: 2, Count: 3, Strategy: pipeline.ShardContiguous}, []int64{9, 10}, nil},
+		{pipeline.Shard{Index: 15, Count: 20, Strategy: pipeline.ShardContiguous}, nil, pipeline.ErrNothingToProcess},
+		{pipeline.Shard{Index: 3, Count: 3, Strategy: pipeline.ShardModulo}, nil, pipeline.ErrInvalidShard},
+		{pipeline.Shard{Index: 0, Count: 0, Strategy: pipeline.ShardContiguous}, nil, pipeline.ErrInvalidShard},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("shard %d of %d with strategy %d", tt.shard.Index, tt.shard.Count, tt.shard.Strategy), func(t *testing.T) {
+			ctx := context.Background()
+
+			source, err := pipeline.NewShardedSource(ctx, &sourceMock{1, 10, 1, false}, heightRange, tt.shard)
+			if err != tt.err {
+				t.Fatalf("exp err: %v, got: %v", tt.err, err)
+			}
+			if err != nil {
+				return
+			}
+
+			heights := []int64{source.Current()}
+			for source.Next(ctx, nil) {
+				heights = append(heights, source.Current())
+			}
+
+			if !reflect.DeepEqual(heights, tt.heights) {
+				t.Errorf("exp: %v, got: %v", tt.heights, heights)
+			}
+		})
+	}
+}
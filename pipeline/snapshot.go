@@ -0,0 +1,115 @@
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"strconv"
+
+	"github.com/figment-networks/indexing-engine/datalake"
+)
+
+// snapshotResourcePrefix is the prefix of names of payload snapshots in the data lake
+const snapshotResourcePrefix = "debug/"
+
+// SnapshotOptions holds options for payload snapshots
+type SnapshotOptions struct {
+	// Stages holds names of stages after which the payload is stored
+	Stages []StageName
+
+	// StartHeight and EndHeight limit snapshots to a closed range of heights. The range is ignored when EndHeight is 0.
+	StartHeight int64
+	EndHeight   int64
+
+	// SampleRate is the fraction of heights, between 0 and 1, for which snapshots are taken.
+	// Heights are sampled deterministically, so the same heights are sampled on every run.
+	SampleRate float64
+}
+
+// snapshotter stores payload snapshots in the data lake for debugging
+type snapshotter struct {
+	dataLake *datalake.DataLake
+	stages   map[StageName]bool
+	options  SnapshotOptions
+}
+
+func newSnapshotter(dl *datalake.DataLake, options SnapshotOptions) *snapshotter {
+	stages := make(map[StageName]bool, len(options.Stages))
+	for _, name := range options.Stages {
+		stages[name] = true
+	}
+
+	return &snapshotter{
+		dataLake: dl,
+		stages:   stages,
+		options:  options,
+	}
+}
+
+// enabled checks if snapshots should be taken for the given height.
+// Snapshots are taken for all heights when neither the range nor the sample rate is set.
+func (s *snapshotter) enabled(height int64) bool {
+	hasRange := s.options.EndHeight != 0
+	hasSampleRate := s.options.SampleRate > 0
+
+	if !hasRange && !hasSampleRate {
+		return true
+	}
+
+	if hasRange && height >= s.options.StartHeight && height <= s.options.EndHeight {
+		return true
+	}
+
+	return hasSampleRate && sampleHeight(height) < s.options.SampleRate
+}
+
+// store stores the payload as JSON under the debug/<stage> name at the given height
+func (s *snapshotter) store(height int64, stageName StageName, payload Payload) error {
+	res, err := datalake.NewJSONResource(payload)
+	if err != nil {
+		return err
+	}
+
+	return s.dataLake.StoreResourceAtHeight(res, snapshotResourcePrefix+string(stageName), height)
+}
+
+// sampleHeight maps the height to a number in [0, 1)
+func sampleHeight(height int64) float64 {
+	h := fnv.New32a()
+	h.Write([]byte(strconv.FormatInt(height, 10)))
+
+	return float64(h.Sum32()) / (math.MaxUint32 + 1)
+}
+
+// snapshotStages stores the payload after each of the given stages that is selected for snapshots.
+// Snapshots are taken after the whole stage group, so concurrent stages never run while the payload is serialized.
+func (p *pipeline) snapshotStages(ctx context.Context, height int64, stages []*stage, payload Payload) {
+	if !p.snapshotter.enabled(height) {
+		return
+	}
+
+	for _, s := range stages {
+		if s == nil {
+			continue
+		}
+
+		names := []StageName{s.Name}
+		for _, anchored := range []map[StageName][]*stage{p.beforeStage, p.afterStage} {
+			for _, a := range anchored[s.Name] {
+				names = append(names, a.Name)
+			}
+		}
+
+		for _, name := range names {
+			if !p.snapshotter.stages[name] {
+				continue
+			}
+
+			path := stagePath(ctx, name)
+			if err := p.snapshotter.store(height, path, payload); err != nil {
+				logInfo(fmt.Sprintf("cannot store payload snapshot for height %d after stage %s: %v", height, path, err))
+			}
+		}
+	}
+}
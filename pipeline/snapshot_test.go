@@ -0,0 +1,137 @@
+package pipeline_test
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+
+	"github.com/figment-networks/indexing-engine/datalake"
+	"github.com/figment-networks/indexing-engine/pipeline"
+	"github.com/figment-networks/indexing-engine/pipeline/mock"
+)
+
+func TestPipeline_SetPayloadSnapshots(t *testing.T) {
+	t.Run("stores payload after selected stages for heights in range", func(t *testing.T) {
+		ctrl, ctx := gomock.WithContext(context.Background(), t)
+		defer ctrl.Finish()
+
+		dir, err := ioutil.TempDir("", "snapshot-")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+
+		storage, err := datalake.NewFileStorage(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		dl := datalake.NewDataLake("network", "chain", storage)
+
+		payloadFactoryMock := mock.NewMockPayloadFactory(ctrl)
+		payloadFactoryMock.EXPECT().GetPayload(gomock.Any()).DoAndReturn(func(int64) pipeline.Payload {
+			return &checkpointPayload{}
+		}).Times(4)
+
+		p := pipeline.NewCustom(payloadFactoryMock)
+
+		p.AddStage(pipeline.NewCustomStage(pipeline.StageFetcher, pipeline.StageRunnerFunc(
+			func(_ context.Context, payload pipeline.Payload, _ pipeline.TaskValidator) error {
+				payload.(*checkpointPayload).Fetched = "block"
+				return nil
+			})))
+		p.AddStage(pipeline.NewCustomStage(pipeline.StageParser, pipeline.StageRunnerFunc(
+			func(_ context.Context, payload pipeline.Payload, _ pipeline.TaskValidator) error {
+				payload.(*checkpointPayload).Parsed = "parsed"
+				return nil
+			})))
+
+		p.SetPayloadSnapshots(dl, pipeline.SnapshotOptions{
+			Stages:      []pipeline.StageName{pipeline.StageFetcher},
+			StartHeight: 2,
+			EndHeight:   3,
+		})
+
+		sinkMock := mock.NewMockSink(ctrl)
+		sinkMock.EXPECT().Consume(gomock.Any(), gomock.Any()).Return(nil).Times(4)
+
+		if err := p.Start(ctx, &sourceMock{1, 4, 1, false}, sinkMock, nil); err != nil {
+			t.Fatalf("did not expect error, got: %v", err)
+		}
+
+		for height := int64(1); height <= 4; height++ {
+			stored, err := dl.IsResourceStoredAtHeight("debug/"+string(pipeline.StageFetcher), height)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if exp := height == 2 || height == 3; stored != exp {
+				t.Errorf("height %d: exp stored: %v, got: %v", height, exp, stored)
+			}
+
+			stored, err = dl.IsResourceStoredAtHeight("debug/"+string(pipeline.StageParser), height)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if stored {
+				t.Errorf("height %d: did not expect parser snapshot", height)
+			}
+		}
+
+		res, err := dl.RetrieveResourceAtHeight("debug/"+string(pipeline.StageFetcher), 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var snapshot checkpointPayload
+		if err := res.ScanJSON(&snapshot); err != nil {
+			t.Fatal(err)
+		}
+		if snapshot.Fetched != "block" || snapshot.Parsed != "" {
+			t.Errorf("unexpected snapshot: %+v", snapshot)
+		}
+	})
+
+	t.Run("stores payload after failed stage", func(t *testing.T) {
+		ctrl, ctx := gomock.WithContext(context.Background(), t)
+		defer ctrl.Finish()
+
+		dir, err := ioutil.TempDir("", "snapshot-")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+
+		storage, err := datalake.NewFileStorage(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		dl := datalake.NewDataLake("network", "chain", storage)
+
+		payloadFactoryMock := mock.NewMockPayloadFactory(ctrl)
+		payloadFactoryMock.EXPECT().GetPayload(int64(7)).Return(&checkpointPayload{}).Times(1)
+
+		p := pipeline.NewCustom(payloadFactoryMock)
+		p.AddStage(pipeline.NewCustomStage(pipeline.StageFetcher, pipeline.StageRunnerFunc(
+			func(_ context.Context, payload pipeline.Payload, _ pipeline.TaskValidator) error {
+				payload.(*checkpointPayload).Fetched = "partial"
+				return errors.New("fetcher err")
+			})))
+
+		p.SetPayloadSnapshots(dl, pipeline.SnapshotOptions{Stages: []pipeline.StageName{pipeline.StageFetcher}})
+
+		if _, err := p.Run(ctx, 7, nil); err == nil {
+			t.Fatalf("expected error")
+		}
+
+		stored, err := dl.IsResourceStoredAtHeight("debug/"+string(pipeline.StageFetcher), 7)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !stored {
+			t.Errorf("expected snapshot to be stored")
+		}
+	})
+}
@@ -14,6 +14,9 @@ var (
 	_ Stage = (*stage)(nil)
 )
 
+// ctxTaskSkipper is the context key under which the task skipper of the source is stored
+const ctxTaskSkipper = ctxKey("task_skipper")
+
 // NewStageWithTasks creates a stage with tasks that will run one by one
 func NewStageWithTasks(name StageName, tasks ...Task) *stage {
 	return &stage{
@@ -45,13 +48,23 @@ type stage struct {
 
 // Run runs the stage runner assigned to stage
 func (s *stage) Run(ctx context.Context, payload Payload, options *Options) error {
-	observer := stageDurationMetric.WithLabels(string(s.Name))
+	name := string(stagePath(ctx, s.Name))
+	observer := stageDurationMetric.WithLabels(name)
 
 	timer := metrics.NewTimer(observer)
 	defer timer.ObserveDuration()
 
+	skipper, _ := ctx.Value(ctxTaskSkipper).(TaskSkipper)
+
 	return s.runner.Run(ctx, payload, func(taskName string) bool {
-		return s.canRunTask(taskName, options)
+		if !s.canRunTask(taskName, options) {
+			return false
+		}
+		if skipper != nil && skipper.SkipTask(s.Name, taskName) {
+			tasksSkippedMetric.WithLabels(name, taskName).Inc()
+			return false
+		}
+		return true
 	})
 }
 
@@ -70,12 +83,15 @@ func (s *stage) canRunTask(taskName string, options *Options) bool {
 
 // runTask executes a pipeline task
 func runTask(ctx context.Context, task Task, payload Payload) error {
-	observer := taskDurationMetric.WithLabels(task.GetName())
+	taskName := task.GetName()
+	observer := taskDurationMetric.WithLabels(taskName)
 
 	timer := metrics.NewTimer(observer)
 	defer timer.ObserveDuration()
 
-	return task.Run(ctx, payload)
+	return watchTask(ctx, taskName, func(ctx context.Context) error {
+		return task.Run(ctx, payload)
+	})
 }
 
 type syncRunner struct {
@@ -127,15 +143,19 @@ func (ar asyncRunner) Run(ctx context.Context, payload Payload, canRunTask TaskV
 	return errs
 }
 
-// retryingStageRunner implement retry mechanism for stageRunner
+// retryingStageRunner implement retry mechanism for stageRunner.
+// isTransient can be nil, in which case only errors wrapped with Transient are retried.
 func retryingStageRunner(sr stageRunner, isTransient func(error) bool, maxRetries int) stageRunner {
 	return StageRunnerFunc(func(ctx context.Context, p Payload, f TaskValidator) error {
 		var err error
 		for i := 0; i < maxRetries; i++ {
 			if err = sr.Run(ctx, p, f); err != nil {
-				if !isTransient(err) {
+				if !isRetryable(err, isTransient) {
 					return err
 				}
+				if i < maxRetries-1 {
+					publishEvent(ctx, Event{Type: EventTaskRetried, Attempt: i + 1, Err: err})
+				}
 			} else {
 				break
 			}
@@ -162,9 +182,12 @@ func (r *retryTask) Run(ctx context.Context, p Payload) error {
 	var err error
 	for i := 0; i < r.maxRetries; i++ {
 		if err = runTask(ctx, r.task, p); err != nil {
-			if !r.isTransient(err) {
+			if !isRetryable(err, r.isTransient) {
 				return err
 			}
+			if i < r.maxRetries-1 {
+				publishEvent(ctx, Event{Type: EventTaskRetried, Task: r.name, Attempt: i + 1, Err: err})
+			}
 		} else {
 			break
 		}
@@ -172,7 +195,9 @@ func (r *retryTask) Run(ctx context.Context, p Payload) error {
 	return err
 }
 
-// RetryingTask implements retry mechanism for Task
+// RetryingTask implements retry mechanism for Task.
+// Errors wrapped with Transient are always retried and errors wrapped with Permanent or SkipHeight never are.
+// Other errors are retried when isTransient returns true; isTransient can be nil.
 func RetryingTask(st Task, isTransient func(error) bool, maxRetries int) Task {
 	return &retryTask{
 		name:        st.GetName(),
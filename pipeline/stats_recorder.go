@@ -1,21 +1,50 @@
 package pipeline
 
 import (
+	"sync"
 	"time"
 )
 
 // StateRecorder is responsible for recording statistics during pipeline execution
-// TODO: Add stats for every stage and every task
+// TODO: Add stats for every task
 func NewStatsRecorder() *StatsRecorder {
 	return &StatsRecorder{
 		Stat: Stat{
 			StartTime: time.Now(),
 		},
+		stages: make(map[StageName]Stat),
 	}
 }
 
 type StatsRecorder struct {
 	Stat
+
+	mu     sync.Mutex
+	stages map[StageName]Stat
+}
+
+// RecordStage records the stat of the most recent run of a stage
+func (sr *StatsRecorder) RecordStage(stageName StageName, stat Stat) {
+	sr.mu.Lock()
+	defer sr.mu.Unlock()
+
+	if sr.stages == nil {
+		sr.stages = make(map[StageName]Stat)
+	}
+	sr.stages[stageName] = stat
+}
+
+// StageStats returns stats of all stages run so far.
+// Stages of sub-pipelines are keyed by their hierarchical names.
+func (sr *StatsRecorder) StageStats() map[StageName]Stat {
+	sr.mu.Lock()
+	defer sr.mu.Unlock()
+
+	stats := make(map[StageName]Stat, len(sr.stages))
+	for name, stat := range sr.stages {
+		stats[name] = stat
+	}
+	return stats
 }
 
 func NewStat() *Stat {
@@ -0,0 +1,81 @@
+package pipeline
+
+import (
+	"context"
+	"fmt"
+)
+
+const (
+	// ctxOptions is the context key under which options of the current run are stored
+	ctxOptions = ctxKey("options")
+
+	// ctxStagePrefix is the context key under which the name of the parent stage of a sub-pipeline is stored
+	ctxStagePrefix = ctxKey("stage_prefix")
+
+	// stagePathSeparator separates names of parent and child stages
+	stagePathSeparator = "/"
+)
+
+var (
+	_ stageRunner = (*pipelineRunner)(nil)
+)
+
+// NewPipelineStage creates a stage which runs all stages of the child pipeline.
+// mapPayload maps the parent payload to the payload of the child pipeline; when nil the payload is shared.
+// The child pipeline inherits options of the parent, and its stages are reported in metrics, events and stats
+// under hierarchical names, e.g. "stage_aggregator/stage_rewards".
+func NewPipelineStage(name StageName, child CustomPipeline, mapPayload func(Payload) Payload) *stage {
+	s := &stage{Name: name}
+
+	// Stage without a runner is reported by Validate
+	if p, ok := child.(*pipeline); ok {
+		s.runner = &pipelineRunner{
+			name:       name,
+			child:      p,
+			mapPayload: mapPayload,
+		}
+	}
+
+	return s
+}
+
+// pipelineRunner runs a child pipeline as a single stage
+type pipelineRunner struct {
+	name       StageName
+	child      *pipeline
+	mapPayload func(Payload) Payload
+}
+
+// Run runs all stages of the child pipeline
+func (r *pipelineRunner) Run(ctx context.Context, payload Payload, _ TaskValidator) error {
+	if r.mapPayload != nil {
+		payload = r.mapPayload(payload)
+	}
+
+	options, _ := ctx.Value(ctxOptions).(*Options)
+
+	ctx = context.WithValue(ctx, ctxStagePrefix, stagePath(ctx, r.name))
+
+	return r.child.runStages(ctx, eventHeight(ctx), payload, NewSource(), options)
+}
+
+// validate validates the child pipeline
+func (r *pipelineRunner) validate() error {
+	if err := r.child.Validate(); err != nil {
+		return fmt.Errorf("sub-pipeline %s: %w", r.name, err)
+	}
+	return nil
+}
+
+// withOptions returns a context holding options of the current run, so they can be inherited by sub-pipelines
+func withOptions(ctx context.Context, options *Options) context.Context {
+	return context.WithValue(ctx, ctxOptions, options)
+}
+
+// stagePath returns the hierarchical name of the stage, prefixed with names of parent stages of sub-pipelines
+func stagePath(ctx context.Context, stageName StageName) StageName {
+	if prefix, ok := ctx.Value(ctxStagePrefix).(StageName); ok {
+		return prefix + stagePathSeparator + stageName
+	}
+	return stageName
+}
@@ -0,0 +1,147 @@
+package pipeline_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+
+	"github.com/figment-networks/indexing-engine/pipeline"
+	"github.com/figment-networks/indexing-engine/pipeline/mock"
+)
+
+type rewardsPayload struct {
+	parent  *heightPayload
+	rewards []string
+}
+
+func (p *rewardsPayload) MarkAsProcessed() {}
+
+func TestPipeline_NewPipelineStage(t *testing.T) {
+	t.Run("child pipeline runs as a single stage", func(t *testing.T) {
+		ctrl, ctx := gomock.WithContext(context.Background(), t)
+		defer ctrl.Finish()
+
+		var calls []string
+		var childPayload *rewardsPayload
+
+		child := pipeline.NewCustom(nil)
+		child.AddStage(pipeline.NewCustomStage("stage_validators", pipeline.StageRunnerFunc(
+			func(_ context.Context, payload pipeline.Payload, _ pipeline.TaskValidator) error {
+				calls = append(calls, "validators")
+				childPayload = payload.(*rewardsPayload)
+				childPayload.rewards = append(childPayload.rewards, "validator")
+				return nil
+			})))
+
+		delegatorTask := mock.NewMockTask(ctrl)
+		delegatorTask.EXPECT().GetName().Return("delegatorTask").Times(1)
+		delegatorTask.EXPECT().Run(gomock.Any(), gomock.Any()).Times(0)
+
+		rewardsTask := mock.NewMockTask(ctrl)
+		rewardsTask.EXPECT().GetName().Return("rewardsTask").Times(2)
+		rewardsTask.EXPECT().Run(gomock.Any(), gomock.Any()).DoAndReturn(func(context.Context, pipeline.Payload) error {
+			calls = append(calls, "rewards")
+			return nil
+		}).Times(1)
+		child.AddStage(pipeline.NewStageWithTasks("stage_delegators", delegatorTask, rewardsTask))
+
+		p := pipeline.NewCustom(heightPayloadFactory{})
+		p.AddStage(pipeline.NewCustomStage(pipeline.StageFetcher, pipeline.StageRunnerFunc(
+			func(context.Context, pipeline.Payload, pipeline.TaskValidator) error {
+				calls = append(calls, "fetcher")
+				return nil
+			})))
+		p.AddStage(pipeline.NewPipelineStage(pipeline.StageAggregator, child, func(payload pipeline.Payload) pipeline.Payload {
+			return &rewardsPayload{parent: payload.(*heightPayload)}
+		}))
+		p.AddStage(pipeline.NewCustomStage(pipeline.StagePersistor, pipeline.StageRunnerFunc(
+			func(context.Context, pipeline.Payload, pipeline.TaskValidator) error {
+				calls = append(calls, "persistor")
+				return nil
+			})))
+
+		var stageStats map[pipeline.StageName]pipeline.Stat
+		sinkMock := mock.NewMockSink(ctrl)
+		sinkMock.EXPECT().Consume(gomock.Any(), gomock.Any()).DoAndReturn(func(ctx context.Context, _ pipeline.Payload) error {
+			stageStats = ctx.Value(pipeline.CtxStats).(*pipeline.StatsRecorder).StageStats()
+			return nil
+		}).Times(1)
+
+		events := p.Subscribe(20)
+		defer p.Unsubscribe(events)
+
+		options := &pipeline.Options{TaskWhitelist: []pipeline.TaskName{"rewardsTask"}}
+
+		if err := p.Start(ctx, &sourceMock{3, 3, 3, false}, sinkMock, options); err != nil {
+			t.Fatalf("did not expect error, got: %v", err)
+		}
+
+		expCalls := []string{"fetcher", "validators", "rewards", "persistor"}
+		if len(calls) != len(expCalls) {
+			t.Fatalf("exp: %v, got: %v", expCalls, calls)
+		}
+		for i := range expCalls {
+			if calls[i] != expCalls[i] {
+				t.Errorf("exp: %v, got: %v", expCalls, calls)
+			}
+		}
+
+		if childPayload == nil || childPayload.parent.height != 3 || len(childPayload.rewards) != 1 {
+			t.Errorf("expected mapped child payload, got: %+v", childPayload)
+		}
+
+		expStages := []pipeline.StageName{
+			pipeline.StageFetcher,
+			"stage_aggregator/stage_validators",
+			"stage_aggregator/stage_delegators",
+			pipeline.StageAggregator,
+			pipeline.StagePersistor,
+		}
+		for _, name := range expStages {
+			if stat, ok := stageStats[name]; !ok || !stat.Success {
+				t.Errorf("expected successful stat for stage %s, got: %+v", name, stageStats)
+			}
+		}
+
+		var startedStages []pipeline.StageName
+		for len(events) > 0 {
+			if e := <-events; e.Type == pipeline.EventStageStarted {
+				startedStages = append(startedStages, e.Stage)
+			}
+		}
+		if len(startedStages) != 5 || startedStages[2] != "stage_aggregator/stage_validators" {
+			t.Errorf("unexpected stage events: %v", startedStages)
+		}
+	})
+
+	t.Run("child pipeline errors are returned by parent", func(t *testing.T) {
+		childErr := errors.New("child err")
+
+		child := pipeline.NewCustom(nil)
+		child.AddStage(pipeline.NewCustomStage("stage_child", pipeline.StageRunnerFunc(
+			func(context.Context, pipeline.Payload, pipeline.TaskValidator) error {
+				return childErr
+			})))
+
+		p := pipeline.NewCustom(heightPayloadFactory{})
+		p.AddStage(pipeline.NewPipelineStage(pipeline.StageAggregator, child, nil))
+
+		if _, err := p.Run(context.Background(), 1, nil); err != childErr {
+			t.Errorf("exp: %v, got: %v", childErr, err)
+		}
+	})
+
+	t.Run("invalid child pipeline fails parent validation", func(t *testing.T) {
+		child := pipeline.NewCustom(nil)
+		child.AddStage(pipeline.NewCustomStage("stage_child", nil))
+
+		p := pipeline.NewCustom(heightPayloadFactory{})
+		p.AddStage(pipeline.NewPipelineStage(pipeline.StageAggregator, child, nil))
+
+		if err := p.Validate(); !errors.Is(err, pipeline.ErrMissingRunner) {
+			t.Errorf("exp: %v, got: %v", pipeline.ErrMissingRunner, err)
+		}
+	})
+}
@@ -0,0 +1,100 @@
+package pipeline
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/hashicorp/go-multierror"
+)
+
+var (
+	// ErrUnknownStage is returned when the pipeline refers to a stage that was not added to it
+	ErrUnknownStage = errors.New("unknown stage")
+
+	// ErrDuplicateStage is returned when more than one stage has the same name
+	ErrDuplicateStage = errors.New("duplicate stage name")
+
+	// ErrMissingRunner is returned when a stage has no runner
+	ErrMissingRunner = errors.New("stage has no runner")
+)
+
+// Validate checks if the pipeline is configured correctly.
+// It reports unknown stages referenced by the pipeline configuration, duplicate stage names,
+// stages without a runner and empty concurrent stage groups. Start, Run and RunRange call it automatically.
+func (p *pipeline) Validate() error {
+	var errs error
+	for _, err := range p.configErrs {
+		errs = multierror.Append(errs, err)
+	}
+
+	names := make(map[StageName]bool)
+	checkStage := func(s *stage) {
+		if s == nil {
+			errs = multierror.Append(errs, ErrMissingStage)
+			return
+		}
+		if names[s.Name] {
+			errs = multierror.Append(errs, fmt.Errorf("%w: %s", ErrDuplicateStage, s.Name))
+		}
+		names[s.Name] = true
+		if s.runner == nil {
+			errs = multierror.Append(errs, fmt.Errorf("%w: %s", ErrMissingRunner, s.Name))
+		}
+		if r, ok := s.runner.(*pipelineRunner); ok {
+			if err := r.validate(); err != nil {
+				errs = multierror.Append(errs, err)
+			}
+		}
+	}
+
+	for _, stages := range p.stages {
+		if len(stages) == 0 {
+			errs = multierror.Append(errs, ErrMissingStages)
+		}
+		for _, s := range stages {
+			checkStage(s)
+		}
+	}
+
+	// Anchors of before and after stages must be the main stages of the pipeline
+	mainStages := make(map[StageName]bool, len(names))
+	for name := range names {
+		mainStages[name] = true
+	}
+
+	for _, anchored := range []map[StageName][]*stage{p.beforeStage, p.afterStage} {
+		for anchor, stages := range anchored {
+			if !mainStages[anchor] {
+				errs = multierror.Append(errs, fmt.Errorf("%w: %s is used as an anchor for other stages", ErrUnknownStage, anchor))
+			}
+			for _, s := range stages {
+				checkStage(s)
+			}
+		}
+	}
+
+	for name := range p.alwaysRun {
+		// Cleanup stage is always run by default, but it doesn't have to be part of the pipeline
+		if name != StageCleanup && !mainStages[name] {
+			errs = multierror.Append(errs, fmt.Errorf("%w: %s is marked as always-run", ErrUnknownStage, name))
+		}
+	}
+
+	if p.checkpointer != nil {
+		for name := range p.checkpointer.stages {
+			if !mainStages[name] {
+				errs = multierror.Append(errs, fmt.Errorf("%w: %s is used for checkpoints", ErrUnknownStage, name))
+			}
+		}
+	}
+
+	if p.snapshotter != nil {
+		for name := range p.snapshotter.stages {
+			if !names[name] {
+				errs = multierror.Append(errs, fmt.Errorf("%w: %s is used for payload snapshots", ErrUnknownStage, name))
+			}
+		}
+	}
+
+	return errs
+}
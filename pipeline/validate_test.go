@@ -0,0 +1,132 @@
+package pipeline_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+
+	"github.com/figment-networks/indexing-engine/pipeline"
+	"github.com/figment-networks/indexing-engine/pipeline/mock"
+)
+
+func TestPipeline_Validate(t *testing.T) {
+	noopRunner := pipeline.StageRunnerFunc(func(context.Context, pipeline.Payload, pipeline.TaskValidator) error {
+		return nil
+	})
+
+	tests := []struct {
+		description string
+		configure   func(p pipeline.CustomPipeline)
+		expErr      error
+	}{
+		{
+			description: "valid pipeline",
+			configure: func(p pipeline.CustomPipeline) {
+				p.AddStage(pipeline.NewCustomStage(pipeline.StageFetcher, noopRunner))
+				p.AddStageBefore(pipeline.StageFetcher, pipeline.NewCustomStage("beforeFetcher", noopRunner))
+				p.AddStageAfter(pipeline.StageFetcher, pipeline.NewCustomStage("afterFetcher", noopRunner))
+				p.RetryStage(pipeline.StageFetcher, nil, 3)
+			},
+		},
+		{
+			description: "unknown anchor stage",
+			configure: func(p pipeline.CustomPipeline) {
+				p.AddStage(pipeline.NewCustomStage(pipeline.StageFetcher, noopRunner))
+				p.AddStageAfter(pipeline.StageParser, pipeline.NewCustomStage("afterParser", noopRunner))
+			},
+			expErr: pipeline.ErrUnknownStage,
+		},
+		{
+			description: "unknown retried stage",
+			configure: func(p pipeline.CustomPipeline) {
+				p.AddStage(pipeline.NewCustomStage(pipeline.StageFetcher, noopRunner))
+				p.RetryStage(pipeline.StageParser, nil, 3)
+			},
+			expErr: pipeline.ErrUnknownStage,
+		},
+		{
+			description: "unknown always-run stage",
+			configure: func(p pipeline.CustomPipeline) {
+				p.AddStage(pipeline.NewCustomStage(pipeline.StageFetcher, noopRunner))
+				p.AlwaysRunStage("unlock")
+			},
+			expErr: pipeline.ErrUnknownStage,
+		},
+		{
+			description: "duplicate stage name",
+			configure: func(p pipeline.CustomPipeline) {
+				p.AddStage(pipeline.NewCustomStage(pipeline.StageFetcher, noopRunner))
+				p.AddStageBefore(pipeline.StageFetcher, pipeline.NewCustomStage(pipeline.StageFetcher, noopRunner))
+			},
+			expErr: pipeline.ErrDuplicateStage,
+		},
+		{
+			description: "nil runner",
+			configure: func(p pipeline.CustomPipeline) {
+				p.AddStage(pipeline.NewCustomStage(pipeline.StageFetcher, nil))
+			},
+			expErr: pipeline.ErrMissingRunner,
+		},
+		{
+			description: "nil stage in concurrent group",
+			configure: func(p pipeline.CustomPipeline) {
+				p.AddConcurrentStages(pipeline.NewCustomStage(pipeline.StageFetcher, noopRunner), nil)
+			},
+			expErr: pipeline.ErrMissingStage,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.description, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			p := pipeline.NewCustom(mock.NewMockPayloadFactory(ctrl))
+			tt.configure(p)
+
+			err := p.Validate()
+			if tt.expErr == nil && err != nil {
+				t.Errorf("did not expect error, got: %v", err)
+			}
+			if tt.expErr != nil && !errors.Is(err, tt.expErr) {
+				t.Errorf("exp: %v, got: %v", tt.expErr, err)
+			}
+		})
+	}
+
+	t.Run("missing default stage", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		p := pipeline.NewDefault(mock.NewMockPayloadFactory(ctrl))
+		p.SetTasks("stage_unknown", mock.NewMockTask(ctrl))
+
+		if err := p.Validate(); !errors.Is(err, pipeline.ErrUnknownStage) {
+			t.Errorf("exp: %v, got: %v", pipeline.ErrUnknownStage, err)
+		}
+	})
+
+	t.Run("start and run fail on invalid pipeline", func(t *testing.T) {
+		ctrl, ctx := gomock.WithContext(context.Background(), t)
+		defer ctrl.Finish()
+
+		payloadFactoryMock := mock.NewMockPayloadFactory(ctrl)
+		payloadFactoryMock.EXPECT().GetPayload(gomock.Any()).Times(0)
+
+		p := pipeline.NewCustom(payloadFactoryMock)
+		p.AddStage(pipeline.NewCustomStage(pipeline.StageFetcher, noopRunner))
+		p.AddStageBefore(pipeline.StageParser, pipeline.NewCustomStage("beforeParser", noopRunner))
+
+		if err := p.Start(ctx, &sourceMock{1, 1, 1, false}, mock.NewMockSink(ctrl), nil); !errors.Is(err, pipeline.ErrUnknownStage) {
+			t.Errorf("exp: %v, got: %v", pipeline.ErrUnknownStage, err)
+		}
+		if _, err := p.Run(ctx, 1, nil); !errors.Is(err, pipeline.ErrUnknownStage) {
+			t.Errorf("exp: %v, got: %v", pipeline.ErrUnknownStage, err)
+		}
+		if _, err := p.RunRange(ctx, 1, 2, nil); !errors.Is(err, pipeline.ErrUnknownStage) {
+			t.Errorf("exp: %v, got: %v", pipeline.ErrUnknownStage, err)
+		}
+	})
+}
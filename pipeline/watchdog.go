@@ -0,0 +1,113 @@
+package pipeline
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"runtime/pprof"
+	"strconv"
+	"time"
+)
+
+// ctxWatchdog is the context key under which the pipeline watchdog is stored
+const ctxWatchdog = ctxKey("watchdog")
+
+// WatchdogOptions holds options for the slow height watchdog
+type WatchdogOptions struct {
+	// StageThreshold is the duration after which a running stage is reported as slow. Stages are not watched when it's 0.
+	StageThreshold time.Duration
+
+	// TaskThreshold is the duration after which a running task is reported as slow. Tasks are not watched when it's 0.
+	TaskThreshold time.Duration
+
+	// DumpDir is the directory goroutine dumps are written to. Dumps are logged when it's empty.
+	DumpDir string
+}
+
+// watchdog reports stages and tasks running longer than configured thresholds
+type watchdog struct {
+	options WatchdogOptions
+}
+
+// watch starts watching a stage or task, which is reported once if it runs longer than threshold.
+// The returned function stops watching and must be called when the stage or task finishes.
+func (w *watchdog) watch(ctx context.Context, threshold time.Duration, taskName string) func() {
+	if threshold <= 0 {
+		return func() {}
+	}
+
+	height, stageName := eventHeight(ctx), eventStage(ctx)
+	timer := time.AfterFunc(threshold, func() {
+		w.report(height, stageName, taskName, threshold)
+	})
+
+	return func() { timer.Stop() }
+}
+
+// report logs a warning with a goroutine dump for the slow stage or task
+func (w *watchdog) report(height int64, stageName StageName, taskName string, threshold time.Duration) {
+	msg := fmt.Sprintf("WARNING: slow height %d, stage %s", height, stageName)
+	if taskName != "" {
+		msg += fmt.Sprintf(", task %s", taskName)
+	}
+	msg += fmt.Sprintf(" running longer than %s", threshold)
+
+	var dump bytes.Buffer
+	if err := pprof.Lookup("goroutine").WriteTo(&dump, 2); err != nil {
+		logInfo(fmt.Sprintf("%s, cannot capture goroutine dump: %v", msg, err))
+		return
+	}
+
+	if w.options.DumpDir == "" {
+		logInfo(fmt.Sprintf("%s, goroutine dump:\n%s", msg, dump.String()))
+		return
+	}
+
+	fileName := filepath.Join(w.options.DumpDir, fmt.Sprintf("goroutines-%d-%d.txt", height, time.Now().UnixNano()))
+	if err := ioutil.WriteFile(fileName, dump.Bytes(), 0644); err != nil {
+		logInfo(fmt.Sprintf("%s, cannot write goroutine dump: %v", msg, err))
+		return
+	}
+
+	logInfo(fmt.Sprintf("%s, goroutine dump written to %s", msg, fileName))
+}
+
+// withWatchdog returns a context with the watchdog used by stages and tasks
+func withWatchdog(ctx context.Context, w *watchdog) context.Context {
+	return context.WithValue(ctx, ctxWatchdog, w)
+}
+
+// watchStage starts watching the stage run with the given context, if the watchdog is enabled
+func watchStage(ctx context.Context) func() {
+	w, ok := ctx.Value(ctxWatchdog).(*watchdog)
+	if !ok {
+		return func() {}
+	}
+	return w.watch(ctx, w.options.StageThreshold, "")
+}
+
+// watchTask runs the task function with pprof labels for stage, task and height, if the watchdog is enabled.
+// The task is reported when it runs longer than the task threshold.
+func watchTask(ctx context.Context, taskName string, run func(context.Context) error) error {
+	w, ok := ctx.Value(ctxWatchdog).(*watchdog)
+	if !ok {
+		return run(ctx)
+	}
+
+	stop := w.watch(ctx, w.options.TaskThreshold, taskName)
+	defer stop()
+
+	labels := pprof.Labels(
+		"stage", string(eventStage(ctx)),
+		"task", taskName,
+		"height", strconv.FormatInt(eventHeight(ctx), 10),
+	)
+
+	var err error
+	pprof.Do(ctx, labels, func(ctx context.Context) {
+		err = run(ctx)
+	})
+	return err
+}
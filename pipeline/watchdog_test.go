@@ -0,0 +1,112 @@
+package pipeline_test
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime/pprof"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+
+	"github.com/figment-networks/indexing-engine/pipeline"
+	"github.com/figment-networks/indexing-engine/pipeline/mock"
+)
+
+func TestPipeline_SetWatchdog(t *testing.T) {
+	t.Run("writes goroutine dump for slow task", func(t *testing.T) {
+		ctrl, ctx := gomock.WithContext(context.Background(), t)
+		defer ctrl.Finish()
+
+		dir, err := ioutil.TempDir("", "watchdog-")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+
+		payloadFactoryMock := mock.NewMockPayloadFactory(ctrl)
+		payloadFactoryMock.EXPECT().GetPayload(int64(9)).Return(&payloadMock{}).Times(1)
+
+		labels := make(map[string]string)
+
+		task := mock.NewMockTask(ctrl)
+		task.EXPECT().GetName().Return("SlowTask").AnyTimes()
+		task.EXPECT().Run(gomock.Any(), gomock.Any()).DoAndReturn(func(ctx context.Context, _ pipeline.Payload) error {
+			for _, key := range []string{"stage", "task", "height"} {
+				labels[key], _ = pprof.Label(ctx, key)
+			}
+			time.Sleep(50 * time.Millisecond)
+			return nil
+		}).Times(1)
+
+		p := pipeline.NewCustom(payloadFactoryMock)
+		p.AddStage(pipeline.NewStageWithTasks(pipeline.StageFetcher, task))
+		p.SetWatchdog(pipeline.WatchdogOptions{
+			TaskThreshold: 5 * time.Millisecond,
+			DumpDir:       dir,
+		})
+
+		if _, err := p.Run(ctx, 9, nil); err != nil {
+			t.Fatalf("did not expect error, got: %v", err)
+		}
+
+		if labels["stage"] != string(pipeline.StageFetcher) || labels["task"] != "SlowTask" || labels["height"] != "9" {
+			t.Errorf("unexpected pprof labels: %v", labels)
+		}
+
+		var dumps []string
+		for deadline := time.Now().Add(time.Second); len(dumps) == 0 && time.Now().Before(deadline); {
+			time.Sleep(10 * time.Millisecond)
+			if dumps, err = filepath.Glob(filepath.Join(dir, "goroutines-9-*.txt")); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if len(dumps) != 1 {
+			t.Fatalf("expected 1 goroutine dump, got: %d", len(dumps))
+		}
+
+		data, err := ioutil.ReadFile(dumps[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(string(data), "goroutine") {
+			t.Errorf("expected goroutine dump, got: %q", data)
+		}
+	})
+
+	t.Run("does not report fast stage", func(t *testing.T) {
+		ctrl, ctx := gomock.WithContext(context.Background(), t)
+		defer ctrl.Finish()
+
+		dir, err := ioutil.TempDir("", "watchdog-")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+
+		payloadFactoryMock := mock.NewMockPayloadFactory(ctrl)
+		payloadFactoryMock.EXPECT().GetPayload(int64(9)).Return(&payloadMock{}).Times(1)
+
+		p := pipeline.NewCustom(payloadFactoryMock)
+		p.AddStage(pipeline.NewCustomStage(pipeline.StageFetcher, pipeline.StageRunnerFunc(
+			func(context.Context, pipeline.Payload, pipeline.TaskValidator) error {
+				return nil
+			})))
+		p.SetWatchdog(pipeline.WatchdogOptions{
+			StageThreshold: time.Second,
+			DumpDir:        dir,
+		})
+
+		if _, err := p.Run(ctx, 9, nil); err != nil {
+			t.Fatalf("did not expect error, got: %v", err)
+		}
+
+		time.Sleep(20 * time.Millisecond)
+		if files, _ := ioutil.ReadDir(dir); len(files) != 0 {
+			t.Errorf("did not expect goroutine dumps, got: %d", len(files))
+		}
+	})
+}
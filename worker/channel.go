@@ -0,0 +1,179 @@
+package worker
+
+import (
+	"errors"
+	"io"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrListenerClosed is returned when dialing or accepting on a closed channel listener
+	ErrListenerClosed = errors.New("listener closed")
+
+	// ErrDialTimeout is returned when a channel listener doesn't accept a connection within DialTimeout
+	ErrDialTimeout = errors.New("dial timeout")
+)
+
+// ChannelListener accepts in-process connections from channel clients.
+// It can be used in tests and when the manager and workers run in a single binary.
+type ChannelListener struct {
+	conns     chan *channelConn
+	closeOnce sync.Once
+	closed    chan struct{}
+}
+
+// NewChannelListener creates a channel listener
+func NewChannelListener() *ChannelListener {
+	return &ChannelListener{
+		conns:  make(chan *channelConn),
+		closed: make(chan struct{}),
+	}
+}
+
+// Accept waits for the next connection from a channel client
+func (l *ChannelListener) Accept() (*ChannelServer, error) {
+	select {
+	case conn := <-l.conns:
+		return &ChannelServer{conn: conn}, nil
+	case <-l.closed:
+		return nil, ErrListenerClosed
+	}
+}
+
+// Close closes the listener, established connections stay open
+func (l *ChannelListener) Close() error {
+	l.closeOnce.Do(func() {
+		close(l.closed)
+	})
+	return nil
+}
+
+// dial establishes a new connection with the listener.
+// It fails if the connection is not accepted within DialTimeout.
+func (l *ChannelListener) dial() (*channelConn, error) {
+	conn := &channelConn{
+		requests:  make(chan Request),
+		responses: make(chan Response),
+		closed:    make(chan struct{}),
+	}
+
+	select {
+	case l.conns <- conn:
+		return conn, nil
+	case <-l.closed:
+		return nil, ErrListenerClosed
+	case <-time.After(DialTimeout):
+		return nil, ErrDialTimeout
+	}
+}
+
+// channelConn represents an in-process connection.
+// Messages are passed as values, so slices and maps in them are shared between both sides.
+type channelConn struct {
+	requests  chan Request
+	responses chan Response
+	closeOnce sync.Once
+	closed    chan struct{}
+}
+
+func (c *channelConn) close() error {
+	c.closeOnce.Do(func() {
+		close(c.closed)
+	})
+	return nil
+}
+
+// ChannelClient interacts with a worker over an in-process connection
+type ChannelClient struct {
+	listener *ChannelListener
+	conn     *channelConn
+}
+
+var _ Client = (*ChannelClient)(nil)
+
+// NewChannelClient creates a client connected to a worker accepting connections on the listener
+func NewChannelClient(listener *ChannelListener) (*ChannelClient, error) {
+	cc := ChannelClient{listener: listener}
+
+	if err := cc.Connect(); err != nil {
+		return nil, err
+	}
+
+	return &cc, nil
+}
+
+// Connect establishes an in-process connection
+func (cc *ChannelClient) Connect() error {
+	conn, err := cc.listener.dial()
+	if err != nil {
+		return err
+	}
+
+	cc.conn = conn
+
+	return nil
+}
+
+// Send sends a request to a worker
+func (cc *ChannelClient) Send(req Request) error {
+	select {
+	case cc.conn.requests <- req:
+		return nil
+	case <-cc.conn.closed:
+		return io.ErrClosedPipe
+	}
+}
+
+// Receive receives a response from a worker
+func (cc *ChannelClient) Receive(res *Response) error {
+	select {
+	case *res = <-cc.conn.responses:
+		return nil
+	case <-cc.conn.closed:
+		return io.EOF
+	}
+}
+
+// Close closes the in-process connection
+func (cc *ChannelClient) Close() error {
+	return cc.conn.close()
+}
+
+// Reconnect reestablishes an in-process connection
+func (cc *ChannelClient) Reconnect() error {
+	cc.Close()
+	return cc.Connect()
+}
+
+// ChannelServer interacts with a manager over an in-process connection
+type ChannelServer struct {
+	conn *channelConn
+}
+
+var _ Server = (*ChannelServer)(nil)
+
+// Receive receives a request from a manager
+func (cs *ChannelServer) Receive(req *Request) error {
+	select {
+	case *req = <-cs.conn.requests:
+		return nil
+	case <-cs.conn.closed:
+		return io.EOF
+	}
+}
+
+// Send sends a response back to a manager
+func (cs *ChannelServer) Send(res Response) error {
+	select {
+	case cs.conn.responses <- res:
+		return nil
+	case <-cs.conn.closed:
+		return io.ErrClosedPipe
+	}
+}
+
+// Close closes the in-process connection
+func (cs *ChannelServer) Close() error {
+	return cs.conn.close()
+}
@@ -0,0 +1,88 @@
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+)
+
+// ErrorCode classifies errors reported in responses
+type ErrorCode string
+
+const (
+	// ErrorCodeUnknown is used for errors without a code
+	ErrorCodeUnknown ErrorCode = "unknown"
+
+	// ErrorCodeInvalidRequest is used when the request can't be handled by the worker
+	ErrorCodeInvalidRequest ErrorCode = "invalid_request"
+
+	// ErrorCodeDeadlineExceeded is used when the request deadline has passed
+	ErrorCodeDeadlineExceeded ErrorCode = "deadline_exceeded"
+
+	// ErrorCodeInternal is used when the worker fails to handle the request, e.g. the handler panics
+	ErrorCodeInternal ErrorCode = "internal"
+)
+
+var (
+	// ErrDeadlineExceeded is returned for requests received after their deadline
+	ErrDeadlineExceeded = errors.New("request deadline exceeded")
+
+	// ErrHandlerPanic is returned for requests whose handler panicked
+	ErrHandlerPanic = errors.New("request handler panicked")
+
+	// ErrLoopStopped is returned for requests received while the worker loop was shutting down
+	ErrLoopStopped = errors.New("worker loop stopped")
+)
+
+// DecodeError is returned when a received message can't be decoded.
+// The connection remains usable, so the worker loop answers such requests with a failed response and carries on.
+type DecodeError struct {
+	// ID is the message ID, if it could be read from the message
+	ID  string
+	Err error
+}
+
+func (e *DecodeError) Error() string { return "cannot decode message: " + e.Err.Error() }
+func (e *DecodeError) Unwrap() error { return e.Err }
+
+// decodeError wraps the error returned when decoding the data, with the ID read from it if possible
+func decodeError(data []byte, err error) error {
+	var msg struct {
+		ID string
+	}
+	json.Unmarshal(data, &msg)
+
+	return &DecodeError{ID: msg.ID, Err: err}
+}
+
+// CodedError is an error with a code reported in responses
+type CodedError struct {
+	Code ErrorCode
+	Err  error
+}
+
+func (e *CodedError) Error() string { return e.Err.Error() }
+func (e *CodedError) Unwrap() error { return e.Err }
+
+// WithErrorCode wraps err into CodedError. It returns nil if err is nil.
+func WithErrorCode(code ErrorCode, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &CodedError{Code: code, Err: err}
+}
+
+// errorCode returns the code of the error, or ErrorCodeUnknown if it has none
+func errorCode(err error) ErrorCode {
+	var coded *CodedError
+	switch {
+	case errors.As(err, &coded):
+		return coded.Code
+	case errors.Is(err, ErrDeadlineExceeded), errors.Is(err, context.DeadlineExceeded):
+		return ErrorCodeDeadlineExceeded
+	case errors.Is(err, ErrHandlerPanic):
+		return ErrorCodeInternal
+	default:
+		return ErrorCodeUnknown
+	}
+}
@@ -1,44 +1,206 @@
 package worker
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"io"
+	"sync"
+	"time"
 )
 
 // Loop represents the processing loop of a worker
 type Loop struct {
-	server Server
+	server         Server
+	maxConcurrency int
+
+	// sendMu serializes responses sent by concurrent handlers
+	sendMu sync.Mutex
 }
 
-// NewLoop creates a worker loop
+// NewLoop creates a worker loop handling one request at a time
 func NewLoop(server Server) *Loop {
-	return &Loop{server: server}
+	return NewConcurrentLoop(server, 1)
 }
 
-// Run starts the worker loop
-func (l *Loop) Run(handler RequestHandler) {
+// NewConcurrentLoop creates a worker loop handling up to maxConcurrency requests at the same time.
+// Responses are sent as soon as handlers return, so they can be sent in a different order than requests were received.
+func NewConcurrentLoop(server Server, maxConcurrency int) *Loop {
+	if maxConcurrency < 1 {
+		maxConcurrency = 1
+	}
+
+	return &Loop{
+		server:         server,
+		maxConcurrency: maxConcurrency,
+	}
+}
+
+// Run starts the worker loop.
+// It returns nil once the server is closed, or the first error receiving requests or sending responses.
+// When the context is canceled, the loop stops receiving requests, waits for requests in progress to be handled
+// and returns the context error. The server should be closed afterwards.
+func (l *Loop) Run(ctx context.Context, handler RequestHandler) (err error) {
+	var wg sync.WaitGroup
+	sendErrs := make(chan error, 1)
+
+	defer func() {
+		wg.Wait()
+
+		// Errors sending responses take precedence, since the server is no longer usable
+		select {
+		case sendErr := <-sendErrs:
+			err = sendErr
+		default:
+		}
+	}()
+
+	sem := make(chan struct{}, l.maxConcurrency)
+
+	stop := make(chan struct{})
+	defer close(stop)
+
+	received := l.receive(stop)
+
 	for {
-		var req Request
+		var rec receivedRequest
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case err := <-sendErrs:
+			return err
+		case rec = <-received:
+		}
+
+		if rec.err != nil {
+			var decodeErr *DecodeError
+			if !errors.As(rec.err, &decodeErr) {
+				if errors.Is(rec.err, io.EOF) {
+					return nil
+				}
+				return rec.err
+			}
+
+			res := Response{
+				ID:    decodeErr.ID,
+				Error: rec.err.Error(),
+				Code:  ErrorCodeInvalidRequest,
+			}
+			if err := l.send(res); err != nil {
+				return err
+			}
+			continue
+		}
+
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			l.send(newResponse(rec.req, ErrLoopStopped))
+			return ctx.Err()
+		}
+
+		wg.Add(1)
+
+		go func(req Request) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+
+			if err := l.send(handle(req, handler)); err != nil {
+				select {
+				case sendErrs <- err:
+				default:
+				}
+			}
+		}(rec.req)
+	}
+}
+
+// receivedRequest represents the outcome of receiving a request
+type receivedRequest struct {
+	req Request
+	err error
+}
+
+// receive receives requests until the server fails or the stop channel is closed.
+// Decode errors don't stop receiving, since the connection remains usable.
+func (l *Loop) receive(stop <-chan struct{}) <-chan receivedRequest {
+	received := make(chan receivedRequest)
+
+	go func() {
+		for {
+			var rec receivedRequest
+			rec.err = l.server.Receive(&rec.req)
 
-		err := l.server.Receive(&req)
-		if err != nil {
-			if errors.Is(err, io.EOF) {
+			select {
+			case received <- rec:
+			case <-stop:
+				return
+			}
+
+			var decodeErr *DecodeError
+			if rec.err != nil && !errors.As(rec.err, &decodeErr) {
 				return
 			}
-			panic(err)
 		}
+	}()
+
+	return received
+}
+
+// send sends the response, serializing responses sent by concurrent handlers
+func (l *Loop) send(res Response) error {
+	l.sendMu.Lock()
+	defer l.sendMu.Unlock()
 
-		err = handler(req)
+	return l.server.Send(res)
+}
+
+// handle runs the handler for the request and builds the response.
+// Requests received after their deadline are not handled.
+func handle(req Request, handler RequestHandler) Response {
+	stats := &ResponseStats{StartTime: time.Now()}
+
+	var err error
+	if req.Expired(stats.StartTime) {
+		err = ErrDeadlineExceeded
+	} else {
+		err = runHandler(req, handler)
+	}
 
-		var msg string
-		if err != nil {
-			msg = err.Error()
+	stats.Duration = time.Since(stats.StartTime)
+
+	res := newResponse(req, err)
+	res.Stats = stats
+
+	return res
+}
+
+// runHandler runs the handler, recovering from panics into ErrHandlerPanic
+func runHandler(req Request, handler RequestHandler) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%w: %v", ErrHandlerPanic, r)
 		}
+	}()
+
+	return handler(req)
+}
 
-		l.server.Send(Response{
-			Height:  req.Height,
-			Success: err == nil,
-			Error:   msg,
-		})
+// newResponse builds the response to the request, which failed with err unless it's nil
+func newResponse(req Request, err error) Response {
+	res := Response{
+		ID:      req.ID,
+		Height:  req.Height,
+		Success: err == nil,
 	}
+
+	if err != nil {
+		res.Error = err.Error()
+		res.Code = errorCode(err)
+	}
+
+	return res
 }
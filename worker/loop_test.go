@@ -0,0 +1,202 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// fakeServer serves queued requests and records the responses
+type fakeServer struct {
+	requests  []Request
+	responses []Response
+
+	// receiveErr is returned once all requests are served, io.EOF is returned when it's nil
+	receiveErr error
+	sendErr    error
+}
+
+func (s *fakeServer) Receive(req *Request) error {
+	if len(s.requests) == 0 {
+		if s.receiveErr != nil {
+			return s.receiveErr
+		}
+		return io.EOF
+	}
+	*req, s.requests = s.requests[0], s.requests[1:]
+	return nil
+}
+
+func (s *fakeServer) Send(res Response) error {
+	if s.sendErr != nil {
+		return s.sendErr
+	}
+	s.responses = append(s.responses, res)
+	return nil
+}
+
+func TestLoop_Run(t *testing.T) {
+	t.Run("responses carry request ID, error code and stats", func(t *testing.T) {
+		expired := time.Now().Add(-time.Minute)
+		server := &fakeServer{requests: []Request{
+			{ID: "1", Height: 1},
+			{ID: "2", Height: 2},
+			{ID: "3", Height: 3, Deadline: &expired},
+		}}
+
+		var handled []int64
+		err := NewLoop(server).Run(context.Background(), func(req Request) error {
+			handled = append(handled, req.Height)
+			if req.Height == 2 {
+				return WithErrorCode(ErrorCodeInvalidRequest, errors.New("unsupported chain"))
+			}
+			return nil
+		})
+		require.NoError(t, err)
+
+		require.Equal(t, []int64{1, 2}, handled)
+		require.Len(t, server.responses, 3)
+
+		res := server.responses[0]
+		require.Equal(t, "1", res.ID)
+		require.True(t, res.Success)
+		require.Empty(t, res.Code)
+		require.NotNil(t, res.Stats)
+
+		res = server.responses[1]
+		require.Equal(t, "2", res.ID)
+		require.False(t, res.Success)
+		require.Equal(t, "unsupported chain", res.Error)
+		require.Equal(t, ErrorCodeInvalidRequest, res.Code)
+
+		res = server.responses[2]
+		require.False(t, res.Success)
+		require.Equal(t, ErrorCodeDeadlineExceeded, res.Code)
+	})
+}
+
+func TestLoop_Concurrency(t *testing.T) {
+	t.Run("responses are sent as handlers complete", func(t *testing.T) {
+		server := &fakeServer{requests: []Request{
+			{ID: "1", Height: 1},
+			{ID: "2", Height: 2},
+		}}
+
+		secondHandled := make(chan struct{})
+		err := NewConcurrentLoop(server, 2).Run(context.Background(), func(req Request) error {
+			if req.Height == 1 {
+				<-secondHandled
+			} else {
+				close(secondHandled)
+			}
+			return nil
+		})
+		require.NoError(t, err)
+
+		require.Len(t, server.responses, 2)
+		require.Equal(t, "2", server.responses[0].ID)
+		require.Equal(t, "1", server.responses[1].ID)
+	})
+}
+
+func TestLoop_Errors(t *testing.T) {
+	t.Run("malformed requests are answered with failed responses", func(t *testing.T) {
+		managerConn, workerConn := net.Pipe()
+		defer managerConn.Close()
+
+		done := make(chan error)
+		go func() {
+			done <- NewLoop(NewStreamServer(workerConn)).Run(context.Background(), successHandler)
+		}()
+
+		require.NoError(t, writeFrame(managerConn, map[string]interface{}{"ID": "1", "Height": "one"}))
+
+		var res Response
+		require.NoError(t, readFrame(managerConn, &res))
+		require.Equal(t, "1", res.ID)
+		require.False(t, res.Success)
+		require.Equal(t, ErrorCodeInvalidRequest, res.Code)
+
+		require.NoError(t, writeFrame(managerConn, Request{ID: "2", Height: 2}))
+		require.NoError(t, readFrame(managerConn, &res))
+		require.Equal(t, "2", res.ID)
+		require.True(t, res.Success)
+
+		require.NoError(t, managerConn.Close())
+		require.NoError(t, <-done)
+	})
+
+	t.Run("handler panics fail the request", func(t *testing.T) {
+		server := &fakeServer{requests: []Request{{ID: "1", Height: 1}, {ID: "2", Height: 2}}}
+
+		err := NewLoop(server).Run(context.Background(), func(req Request) error {
+			if req.Height == 1 {
+				panic("nil block")
+			}
+			return nil
+		})
+		require.NoError(t, err)
+
+		require.Len(t, server.responses, 2)
+		require.False(t, server.responses[0].Success)
+		require.Equal(t, ErrorCodeInternal, server.responses[0].Code)
+		require.Contains(t, server.responses[0].Error, "nil block")
+		require.True(t, server.responses[1].Success)
+	})
+
+	t.Run("receive and send errors are returned", func(t *testing.T) {
+		receiveErr := errors.New("connection reset")
+		server := &fakeServer{receiveErr: receiveErr}
+		require.Equal(t, receiveErr, NewLoop(server).Run(context.Background(), successHandler))
+
+		sendErr := errors.New("broken pipe")
+		server = &fakeServer{requests: []Request{{Height: 1}}, sendErr: sendErr}
+		require.Equal(t, sendErr, NewLoop(server).Run(context.Background(), successHandler))
+	})
+}
+
+func TestLoop_Drain(t *testing.T) {
+	t.Run("requests in progress are answered on shutdown", func(t *testing.T) {
+		managerConn, workerConn := net.Pipe()
+		defer managerConn.Close()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		started := make(chan struct{})
+		release := make(chan struct{})
+
+		done := make(chan error)
+		go func() {
+			done <- NewLoop(NewStreamServer(workerConn)).Run(ctx, func(Request) error {
+				close(started)
+				<-release
+				return nil
+			})
+		}()
+
+		require.NoError(t, writeFrame(managerConn, Request{ID: "1", Height: 1}))
+		<-started
+		cancel()
+
+		select {
+		case <-done:
+			t.Fatal("loop returned before the request was handled")
+		case <-time.After(50 * time.Millisecond):
+		}
+
+		close(release)
+
+		var res Response
+		require.NoError(t, readFrame(managerConn, &res))
+		require.Equal(t, "1", res.ID)
+		require.True(t, res.Success)
+
+		require.Equal(t, context.Canceled, <-done)
+	})
+}
@@ -0,0 +1,61 @@
+package worker
+
+import "github.com/figment-networks/indexing-engine/metrics"
+
+var (
+	heightsDispatchedMetric = metrics.MustNewCounterWithTags(metrics.Options{
+		Namespace: "indexer",
+		Subsystem: "worker",
+		Name:      "heights_dispatched_total",
+		Desc:      "The total number of heights sent to a worker",
+		Tags:      []string{"worker"},
+	})
+
+	heightsSucceededMetric = metrics.MustNewCounterWithTags(metrics.Options{
+		Namespace: "indexer",
+		Subsystem: "worker",
+		Name:      "heights_succeeded_total",
+		Desc:      "The total number of heights processed successfully by a worker",
+		Tags:      []string{"worker"},
+	})
+
+	heightsFailedMetric = metrics.MustNewCounterWithTags(metrics.Options{
+		Namespace: "indexer",
+		Subsystem: "worker",
+		Name:      "heights_failed_total",
+		Desc:      "The total number of failed attempts to process a height on a worker",
+		Tags:      []string{"worker"},
+	})
+
+	inFlightMetric = metrics.MustNewGaugeWithTags(metrics.Options{
+		Namespace: "indexer",
+		Subsystem: "worker",
+		Name:      "requests_in_flight",
+		Desc:      "The number of requests sent to a worker and not answered yet",
+		Tags:      []string{"worker"},
+	})
+
+	requestDurationMetric = metrics.MustNewHistogramWithTags(metrics.HistogramOptions{
+		Namespace: "indexer",
+		Subsystem: "worker",
+		Name:      "request_duration",
+		Desc:      "The time between sending a request to a worker and receiving its response",
+		Tags:      []string{"worker"},
+	})
+
+	reconnectsMetric = metrics.MustNewCounterWithTags(metrics.Options{
+		Namespace: "indexer",
+		Subsystem: "worker",
+		Name:      "reconnects_total",
+		Desc:      "The total number of attempts to reestablish the connection with a worker",
+		Tags:      []string{"worker"},
+	})
+
+	backoffDelayMetric = metrics.MustNewGaugeWithTags(metrics.Options{
+		Namespace: "indexer",
+		Subsystem: "worker",
+		Name:      "backoff_delay_seconds",
+		Desc:      "The current delay before reestablishing the connection with a worker",
+		Tags:      []string{"worker"},
+	})
+)
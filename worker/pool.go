@@ -1,53 +1,465 @@
 package worker
 
 import (
-	"reflect"
+	"errors"
+	"strconv"
 	"sync"
+	"time"
 )
 
-// Pool represents a pool of workers
+const (
+	// DefaultMaxAttempts is the number of attempts made to process a height when PoolOptions.MaxAttempts is not set
+	DefaultMaxAttempts = 3
+
+	// DefaultQueueSize is the number of requests queued for workers when PoolOptions.QueueSize is not set
+	DefaultQueueSize = 1000
+)
+
+var (
+	// ErrQueueFull is returned by Submit when the queue of requests waiting for workers is full
+	ErrQueueFull = errors.New("pool queue is full")
+
+	// ErrPoolStopped is returned by Submit when the pool is stopped.
+	// Requests pending when the pool is stopped are passed to the dead letter handler with it.
+	ErrPoolStopped = errors.New("pool stopped")
+)
+
+// DeadLetterHandler handles a height which could not be processed in the maximum number of attempts, or was pending when the pool stopped
+type DeadLetterHandler func(height int64, err error)
+
+// PoolOptions holds options for a pool
+type PoolOptions struct {
+	// MaxAttempts is the maximum number of attempts to process a height, DefaultMaxAttempts is used when it's 0
+	MaxAttempts int
+
+	// DeadLetterHandler is called with heights given up after MaxAttempts, it can be nil
+	DeadLetterHandler DeadLetterHandler
+
+	// AcceptWorker decides if a worker registering with the manager joins the pool, all workers are accepted when it's nil
+	AcceptWorker func(Registration) error
+
+	// RegistrationAuth authenticates workers registering with the manager like websocket handshakes,
+	// the ID of the worker takes the place of the path. All registrations are accepted when it's empty.
+	RegistrationAuth WebsocketAuth
+
+	// Scheduler decides which worker processes a request, LeastInFlightScheduler is used when it's nil
+	Scheduler Scheduler
+
+	// QueueSize is the maximum number of requests waiting for workers, DefaultQueueSize is used when it's 0.
+	// Redelivered requests are queued even when the queue is full.
+	QueueSize int
+}
+
+// Pool represents a pool of workers.
+// Requests are queued and dispatched to workers with free capacity, as chosen by the scheduler.
+// Heights which fail or can't be delivered to a worker are redelivered until they reach the maximum number of attempts.
+// Workers can join and leave the pool while it's running.
 type Pool struct {
-	workers []*PoolWorker
+	options PoolOptions
 	wg      sync.WaitGroup
+
+	initOnce sync.Once
+	stopOnce sync.Once
+	quit     chan struct{}
+
+	mu sync.Mutex
+	// cond signals changes of the queue, the workers or their load
+	cond     *sync.Cond
+	workers  []*PoolWorker
+	inFlight map[*PoolWorker]int
+	// lastWorker is the number of workers added to the pool, used to name them
+	lastWorker int
+	queue      []Request
+	handler    ResponseHandler
+	running    bool
+	stopped    bool
+	// attempts holds the number of failed attempts of pending requests by their sequence number
+	attempts map[uint64]int
+	// lastSeq is used to give pending requests unique sequence numbers, IDs set by callers may repeat
+	lastSeq uint64
+	// registering holds IDs of workers registering with the manager, which haven't joined the pool yet
+	registering map[string]bool
+}
+
+// NewPool creates a worker pool
+func NewPool(options PoolOptions) *Pool {
+	return &Pool{options: options}
+}
+
+// init initializes the pool, so the zero value of Pool is ready to use
+func (p *Pool) init() {
+	p.initOnce.Do(func() {
+		p.quit = make(chan struct{})
+		p.cond = sync.NewCond(&p.mu)
+		p.inFlight = make(map[*PoolWorker]int)
+		p.attempts = make(map[uint64]int)
+		p.registering = make(map[string]bool)
+		p.options.RegistrationAuth.nonces = newNonceCache()
+	})
 }
 
-// AddWorker adds a worker to the pool
+// AddWorker adds a worker to the pool. Workers added to a running pool start right away,
+// workers added to a stopped pool are stopped.
 func (p *Pool) AddWorker(worker *PoolWorker) {
+	p.init()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.stopped {
+		worker.Stop()
+		return
+	}
+
+	p.lastWorker++
+	if worker.name == "" {
+		worker.name = "worker-" + strconv.Itoa(p.lastWorker)
+	}
+
 	p.workers = append(p.workers, worker)
+	p.inFlight[worker] = 0
+	if p.running {
+		go p.runWorker(worker)
+	}
+	p.cond.Broadcast()
+}
+
+// RemoveWorker stops the worker, closing its client, and removes it from the pool.
+// Heights in flight on the worker are delivered to other workers.
+func (p *Pool) RemoveWorker(worker *PoolWorker) {
+	worker.Stop()
+	p.removeWorker(worker)
+}
+
+func (p *Pool) removeWorker(worker *PoolWorker) {
+	p.init()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for i, w := range p.workers {
+		if w == worker {
+			p.workers = append(p.workers[:i:i], p.workers[i+1:]...)
+			delete(p.inFlight, worker)
+			p.cond.Broadcast()
+			return
+		}
+	}
+}
+
+// States returns the current state of each worker in the pool
+func (p *Pool) States() []WorkerState {
+	workers := p.Workers()
+
+	states := make([]WorkerState, len(workers))
+	for i, worker := range workers {
+		states[i] = worker.State()
+	}
+	return states
+}
+
+// Workers returns the workers in the pool
+func (p *Pool) Workers() []*PoolWorker {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return append([]*PoolWorker(nil), p.workers...)
 }
 
 // Run starts the worker pool
 func (p *Pool) Run(handler ResponseHandler) {
+	p.init()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.running {
+		return
+	}
+
+	p.handler = handler
+	p.running = true
+
 	for _, worker := range p.workers {
-		go worker.Run(handler, &p.wg)
+		go p.runWorker(worker)
 	}
+
+	go p.schedule()
+}
+
+// runWorker runs the worker until it's stopped, then removes it from the pool
+func (p *Pool) runWorker(worker *PoolWorker) {
+	worker.Run(p.handler, func(req Request, err error) {
+		p.release(worker)
+		p.complete(req, err)
+	})
+	p.removeWorker(worker)
 }
 
 // Process schedules the processing of a given height
 func (p *Pool) Process(height int64) {
+	p.ProcessRequest(Request{Height: height})
+}
+
+// ProcessRequest schedules the processing of a given request.
+// It blocks while the queue of requests waiting for workers is full.
+// Requests processed once the pool is stopped are passed to the dead letter handler with ErrPoolStopped.
+func (p *Pool) ProcessRequest(req Request) {
+	if err := p.enqueue(req, true); err != nil {
+		p.deadLetter(req, err)
+	}
+}
+
+// Submit schedules the processing of a given height without blocking.
+// It returns ErrQueueFull when the queue of requests waiting for workers is full.
+func (p *Pool) Submit(height int64) error {
+	return p.SubmitRequest(Request{Height: height})
+}
+
+// SubmitRequest schedules the processing of a given request without blocking.
+// It returns ErrQueueFull when the queue of requests waiting for workers is full.
+func (p *Pool) SubmitRequest(req Request) error {
+	return p.enqueue(req, false)
+}
+
+// enqueue adds a new request to the queue, waiting for room in the queue if wait is set.
+// Requests get a sequence number unique for the pool, so their attempts are counted separately.
+func (p *Pool) enqueue(req Request, wait bool) error {
+	p.init()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for !p.stopped && len(p.queue) >= p.queueSize() {
+		if !wait {
+			return ErrQueueFull
+		}
+		p.cond.Wait()
+	}
+
+	if p.stopped {
+		return ErrPoolStopped
+	}
+
+	p.lastSeq++
+	req.seq = p.lastSeq
+
 	p.wg.Add(1)
+	p.attempts[req.seq] = 0
+	p.queue = append(p.queue, req)
+	p.cond.Broadcast()
 
-	cases := make([]reflect.SelectCase, len(p.workers))
+	return nil
+}
 
+// requeue queues a request for redelivery, regardless of the size of the queue.
+// Requests are given up if the pool is stopped.
+func (p *Pool) requeue(req Request) {
+	p.mu.Lock()
+	if p.stopped {
+		p.mu.Unlock()
+		p.giveUp(req, ErrPoolStopped)
+		return
+	}
+
+	p.queue = append(p.queue, req)
+	p.cond.Broadcast()
+	p.mu.Unlock()
+}
+
+// schedule dispatches queued requests to workers until the pool is stopped
+func (p *Pool) schedule() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for !p.stopped {
+		if !p.dispatchQueued() {
+			p.cond.Wait()
+		}
+	}
+}
+
+// dispatchQueued dispatches the queued requests which the scheduler assigns to a worker.
+// It returns false if no request was dispatched. It must be called with the lock held.
+func (p *Pool) dispatchQueued() bool {
+	if len(p.queue) == 0 || len(p.workers) == 0 {
+		return false
+	}
+
+	loads := make([]WorkerLoad, len(p.workers))
 	for i, worker := range p.workers {
-		cases[i] = reflect.SelectCase{
-			Dir:  reflect.SelectSend,
-			Chan: reflect.ValueOf(worker.channel),
-			Send: reflect.ValueOf(height),
+		loads[i] = WorkerLoad{
+			Worker:   worker,
+			InFlight: p.inFlight[worker],
+			Capacity: worker.maxInFlight,
+		}
+	}
+
+	dispatched := false
+	queue := p.queue[:0]
+
+	for _, req := range p.queue {
+		i := p.scheduler().Schedule(req, loads)
+		if i < 0 || i >= len(loads) || !loads[i].Available() {
+			queue = append(queue, req)
+			continue
 		}
+
+		loads[i].InFlight++
+		p.inFlight[loads[i].Worker]++
+		dispatched = true
+
+		go p.deliver(loads[i].Worker, req)
 	}
 
-	reflect.Select(cases)
+	for i := len(queue); i < len(p.queue); i++ {
+		p.queue[i] = Request{}
+	}
+	p.queue = queue
+
+	if dispatched {
+		// Wake up callers waiting for room in the queue
+		p.cond.Broadcast()
+	}
+
+	return dispatched
+}
+
+// deliver sends the request to the worker, it's queued again if the worker leaves the pool first
+func (p *Pool) deliver(worker *PoolWorker, req Request) {
+	select {
+	case worker.channel <- req:
+	case <-worker.Done():
+		p.release(worker)
+		p.requeue(req)
+	case <-p.quit:
+		p.release(worker)
+		p.giveUp(req, ErrPoolStopped)
+	}
 }
 
-// Wait blocks until all workers are finished
+// release marks a request dispatched to the worker as completed
+func (p *Pool) release(worker *PoolWorker) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if _, ok := p.inFlight[worker]; ok {
+		p.inFlight[worker]--
+		p.cond.Broadcast()
+	}
+}
+
+// complete records the result of an attempt to process the request.
+// Failed requests are redelivered or passed to the dead letter handler after the last attempt.
+// Invalid and expired requests are passed to the dead letter handler right away, since another attempt can't succeed.
+// Requests in flight on workers which left the pool are redelivered without counting the attempt.
+func (p *Pool) complete(req Request, err error) {
+	if err == nil {
+		p.done(req)
+		return
+	}
+
+	if errors.Is(err, ErrWorkerStopped) {
+		p.requeue(req)
+		return
+	}
+
+	if !retryable(req, err) {
+		p.giveUp(req, err)
+		return
+	}
+
+	p.mu.Lock()
+	p.attempts[req.seq]++
+	attempts := p.attempts[req.seq]
+	p.mu.Unlock()
+
+	if attempts < p.maxAttempts() {
+		p.requeue(req)
+		return
+	}
+
+	p.giveUp(req, err)
+}
+
+// retryable checks if another attempt to process the request can succeed
+func retryable(req Request, err error) bool {
+	switch errorCode(err) {
+	case ErrorCodeInvalidRequest, ErrorCodeDeadlineExceeded:
+		return false
+	}
+	return !req.Expired(time.Now())
+}
+
+// giveUp passes the request to the dead letter handler and marks it as no longer pending
+func (p *Pool) giveUp(req Request, err error) {
+	p.deadLetter(req, err)
+	p.done(req)
+}
+
+// deadLetter passes the request to the dead letter handler, if any
+func (p *Pool) deadLetter(req Request, err error) {
+	if p.options.DeadLetterHandler != nil {
+		p.options.DeadLetterHandler(req.Height, err)
+	}
+}
+
+// done marks the request as no longer pending
+func (p *Pool) done(req Request) {
+	p.mu.Lock()
+	delete(p.attempts, req.seq)
+	p.mu.Unlock()
+
+	p.wg.Done()
+}
+
+func (p *Pool) maxAttempts() int {
+	if p.options.MaxAttempts > 0 {
+		return p.options.MaxAttempts
+	}
+	return DefaultMaxAttempts
+}
+
+func (p *Pool) queueSize() int {
+	if p.options.QueueSize > 0 {
+		return p.options.QueueSize
+	}
+	return DefaultQueueSize
+}
+
+func (p *Pool) scheduler() Scheduler {
+	if p.options.Scheduler != nil {
+		return p.options.Scheduler
+	}
+	return LeastInFlightScheduler{}
+}
+
+// Wait blocks until every request has been processed successfully or passed to the dead letter handler
 func (p *Pool) Wait() {
 	p.wg.Wait()
 }
 
-// Stop stops the worker pool
+// Stop stops the worker pool.
+// Pending requests are passed to the dead letter handler with ErrPoolStopped, so Wait returns.
 func (p *Pool) Stop() {
-	for _, worker := range p.workers {
+	p.init()
+
+	p.stopOnce.Do(func() {
+		close(p.quit)
+
+		p.mu.Lock()
+		p.stopped = true
+		queue := p.queue
+		p.queue = nil
+		p.cond.Broadcast()
+		p.mu.Unlock()
+
+		for _, req := range queue {
+			p.giveUp(req, ErrPoolStopped)
+		}
+	})
+
+	for _, worker := range p.Workers() {
 		worker.Stop()
 	}
 }
@@ -0,0 +1,540 @@
+package worker
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/figment-networks/indexing-engine/backoff"
+)
+
+// fakeClient answers requests with the result of respond
+type fakeClient struct {
+	requests chan Request
+	respond  func(Request) (Response, error)
+}
+
+func newFakeClient(respond func(Request) (Response, error)) *fakeClient {
+	return &fakeClient{
+		requests: make(chan Request, 100),
+		respond:  respond,
+	}
+}
+
+func (c *fakeClient) Send(req Request) error {
+	c.requests <- req
+	return nil
+}
+
+func (c *fakeClient) Receive(res *Response) error {
+	req := <-c.requests
+
+	r, err := c.respond(req)
+	if err != nil {
+		return err
+	}
+	r.ID = req.ID
+	*res = r
+	return nil
+}
+
+func (c *fakeClient) Close() error     { return nil }
+func (c *fakeClient) Reconnect() error { return nil }
+
+func TestPool_Redelivery(t *testing.T) {
+	t.Run("failed heights are redelivered", func(t *testing.T) {
+		var mu sync.Mutex
+		calls := make(map[int64]int)
+
+		respond := func(req Request) (Response, error) {
+			mu.Lock()
+			defer mu.Unlock()
+
+			calls[req.Height]++
+			switch {
+			case req.Height == 2 && calls[req.Height] == 1:
+				return Response{}, errors.New("connection lost")
+			case req.Height == 3 && calls[req.Height] == 1:
+				return Response{Height: req.Height, Error: "fetch failed"}, nil
+			}
+			return Response{Height: req.Height, Success: true}, nil
+		}
+
+		pool := NewPool(PoolOptions{
+			DeadLetterHandler: func(height int64, err error) {
+				t.Errorf("did not expect height %d to be dead-lettered", height)
+			},
+		})
+		pool.AddWorker(NewPoolWorker(newFakeClient(respond)))
+		pool.AddWorker(NewPoolWorker(newFakeClient(respond)))
+		pool.Run(func(Response) {})
+		defer pool.Stop()
+
+		for height := int64(1); height <= 3; height++ {
+			pool.Process(height)
+		}
+		pool.Wait()
+
+		require.Equal(t, map[int64]int{1: 1, 2: 2, 3: 2}, calls)
+	})
+
+	t.Run("heights are dead-lettered after max attempts", func(t *testing.T) {
+		var attempts int
+		client := newFakeClient(func(req Request) (Response, error) {
+			attempts++
+			return Response{Height: req.Height, Error: "bad height"}, nil
+		})
+
+		var deadLetters []int64
+		pool := NewPool(PoolOptions{
+			MaxAttempts: 2,
+			DeadLetterHandler: func(height int64, err error) {
+				require.EqualError(t, err, "bad height")
+				deadLetters = append(deadLetters, height)
+			},
+		})
+		pool.AddWorker(NewPoolWorker(client))
+		pool.Run(func(Response) {})
+		defer pool.Stop()
+
+		pool.Process(7)
+		pool.Wait()
+
+		require.Equal(t, 2, attempts)
+		require.Equal(t, []int64{7}, deadLetters)
+	})
+
+	t.Run("attempts are counted per request", func(t *testing.T) {
+		var mu sync.Mutex
+		var attempts int
+		client := newFakeClient(func(req Request) (Response, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			attempts++
+			return Response{Height: req.Height, Error: "bad range"}, nil
+		})
+
+		var deadLetters []int64
+		pool := NewPool(PoolOptions{
+			MaxAttempts: 2,
+			DeadLetterHandler: func(height int64, err error) {
+				mu.Lock()
+				defer mu.Unlock()
+				deadLetters = append(deadLetters, height)
+			},
+		})
+		pool.AddWorker(NewPoolWorker(client))
+		pool.Run(func(Response) {})
+		defer pool.Stop()
+
+		// Requests sharing a start height don't share attempts
+		pool.ProcessRequest(Request{Height: 1, EndHeight: 5})
+		pool.ProcessRequest(Request{Height: 1, EndHeight: 1})
+		pool.Wait()
+
+		require.Equal(t, 4, attempts)
+		require.Equal(t, []int64{1, 1}, deadLetters)
+	})
+
+	t.Run("invalid and expired requests are dead-lettered without redelivery", func(t *testing.T) {
+		var mu sync.Mutex
+		attempts := make(map[int64]int)
+		client := newFakeClient(func(req Request) (Response, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			attempts[req.Height]++
+			if req.Height == 1 {
+				return Response{Height: req.Height, Error: "bad range", Code: ErrorCodeInvalidRequest}, nil
+			}
+			return Response{Height: req.Height, Error: "fetch failed"}, nil
+		})
+
+		deadLetters := make(map[int64]error)
+		pool := NewPool(PoolOptions{
+			DeadLetterHandler: func(height int64, err error) {
+				mu.Lock()
+				defer mu.Unlock()
+				deadLetters[height] = err
+			},
+		})
+		pool.AddWorker(NewPoolWorker(client))
+		pool.Run(func(Response) {})
+		defer pool.Stop()
+
+		deadline := time.Now().Add(-time.Second)
+		pool.ProcessRequest(Request{Height: 1})
+		pool.ProcessRequest(Request{Height: 2, Deadline: &deadline})
+		pool.Wait()
+
+		mu.Lock()
+		defer mu.Unlock()
+
+		// The expired request isn't waited for, so it may not have reached the client yet
+		require.Equal(t, 1, attempts[1])
+		require.LessOrEqual(t, attempts[2], 1)
+		require.Equal(t, ErrorCodeInvalidRequest, errorCode(deadLetters[1]))
+		require.True(t, errors.Is(deadLetters[2], ErrDeadlineExceeded))
+	})
+
+	t.Run("requests sharing an ID don't share attempts", func(t *testing.T) {
+		var mu sync.Mutex
+		attempts := make(map[int64]int)
+		client := newFakeClient(func(req Request) (Response, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			attempts[req.Height]++
+			return Response{ID: req.ID, Height: req.Height, Error: "bad height"}, nil
+		})
+
+		var deadLetters []int64
+		pool := NewPool(PoolOptions{
+			MaxAttempts: 2,
+			DeadLetterHandler: func(height int64, err error) {
+				mu.Lock()
+				defer mu.Unlock()
+				deadLetters = append(deadLetters, height)
+			},
+		})
+		pool.AddWorker(NewPoolWorker(client))
+		pool.Run(func(Response) {})
+		defer pool.Stop()
+
+		pool.ProcessRequest(Request{ID: "job", Height: 1})
+		pool.ProcessRequest(Request{ID: "job", Height: 2})
+		pool.Wait()
+
+		require.Equal(t, map[int64]int{1: 2, 2: 2}, attempts)
+		require.ElementsMatch(t, []int64{1, 2}, deadLetters)
+	})
+
+	t.Run("pending heights are dead-lettered when pool stops", func(t *testing.T) {
+		unanswered := make(chan struct{})
+		defer close(unanswered)
+
+		client := newFakeClient(func(req Request) (Response, error) {
+			<-unanswered
+			return Response{}, errors.New("connection closed")
+		})
+
+		var mu sync.Mutex
+		var deadLetters []int64
+		pool := NewPool(PoolOptions{
+			DeadLetterHandler: func(height int64, err error) {
+				require.Equal(t, ErrPoolStopped, err)
+				mu.Lock()
+				defer mu.Unlock()
+				deadLetters = append(deadLetters, height)
+			},
+		})
+		pool.AddWorker(NewPoolWorker(client))
+		pool.Run(func(Response) {})
+
+		for height := int64(1); height <= 3; height++ {
+			pool.Process(height)
+		}
+		pool.Stop()
+
+		done := make(chan struct{})
+		go func() {
+			pool.Wait()
+			close(done)
+		}()
+
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			t.Fatal("wait did not return after stop")
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		require.ElementsMatch(t, []int64{1, 2, 3}, deadLetters)
+	})
+
+	t.Run("zero value pool processes heights", func(t *testing.T) {
+		client := newFakeClient(func(req Request) (Response, error) {
+			return Response{Height: req.Height, Success: true}, nil
+		})
+
+		var pool Pool
+		pool.AddWorker(NewPoolWorker(client))
+
+		var received []int64
+		pool.Run(func(res Response) {
+			received = append(received, res.Height)
+		})
+		defer pool.Stop()
+
+		pool.Process(1)
+		pool.Process(2)
+		pool.Wait()
+
+		require.Equal(t, []int64{1, 2}, received)
+	})
+}
+
+// batchClient holds requests until a batch is complete and answers them in reverse order
+type batchClient struct {
+	batchSize int
+	mu        sync.Mutex
+	cond      *sync.Cond
+	requests  []Request
+}
+
+func newBatchClient(batchSize int) *batchClient {
+	c := &batchClient{batchSize: batchSize}
+	c.cond = sync.NewCond(&c.mu)
+	return c
+}
+
+func (c *batchClient) Send(req Request) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.requests = append(c.requests, req)
+	c.cond.Broadcast()
+	return nil
+}
+
+func (c *batchClient) Receive(res *Response) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for len(c.requests) == 0 || len(c.requests) < c.batchSize {
+		c.cond.Wait()
+	}
+
+	req := c.requests[len(c.requests)-1]
+	c.requests = c.requests[:len(c.requests)-1]
+	c.batchSize--
+
+	*res = Response{ID: req.ID, Height: req.Height, Success: true}
+	return nil
+}
+
+func (c *batchClient) Close() error     { return nil }
+func (c *batchClient) Reconnect() error { return nil }
+
+func TestPoolWorker_Multiplexing(t *testing.T) {
+	t.Run("requests in flight are answered out of order", func(t *testing.T) {
+		pool := NewPool(PoolOptions{})
+		pool.AddWorker(NewMultiplexedPoolWorker(newBatchClient(3), 3))
+
+		var mu sync.Mutex
+		var received []int64
+		pool.Run(func(res Response) {
+			mu.Lock()
+			defer mu.Unlock()
+			received = append(received, res.Height)
+		})
+		defer pool.Stop()
+
+		for height := int64(1); height <= 3; height++ {
+			pool.Process(height)
+		}
+		pool.Wait()
+
+		require.ElementsMatch(t, []int64{1, 2, 3}, received)
+	})
+
+	t.Run("requests in flight can share an ID", func(t *testing.T) {
+		pool := NewPool(PoolOptions{
+			DeadLetterHandler: func(height int64, err error) {
+				t.Errorf("did not expect height %d to be dead-lettered", height)
+			},
+		})
+		pool.AddWorker(NewMultiplexedPoolWorker(newBatchClient(2), 2))
+
+		var mu sync.Mutex
+		var received []Response
+		pool.Run(func(res Response) {
+			mu.Lock()
+			defer mu.Unlock()
+			received = append(received, res)
+		})
+		defer pool.Stop()
+
+		pool.ProcessRequest(Request{ID: "job", Height: 1})
+		pool.ProcessRequest(Request{ID: "job", Height: 2})
+		pool.Wait()
+
+		require.Len(t, received, 2)
+		require.ElementsMatch(t, []int64{1, 2}, []int64{received[0].Height, received[1].Height})
+		require.Equal(t, "job", received[0].ID)
+		require.Equal(t, "job", received[1].ID)
+	})
+}
+
+// silentClient accepts requests but never answers them
+type silentClient struct {
+	mu        sync.Mutex
+	requests  []Request
+	closeOnce sync.Once
+	closed    chan struct{}
+	// receiving is the number of calls to Receive which haven't returned yet
+	receiving int32
+}
+
+func newSilentClient() *silentClient {
+	return &silentClient{closed: make(chan struct{})}
+}
+
+func (c *silentClient) Send(req Request) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.requests = append(c.requests, req)
+	return nil
+}
+
+func (c *silentClient) Receive(*Response) error {
+	atomic.AddInt32(&c.receiving, 1)
+	defer atomic.AddInt32(&c.receiving, -1)
+
+	<-c.closed
+	return errors.New("connection closed")
+}
+
+func (c *silentClient) sent() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.requests)
+}
+
+func (c *silentClient) Close() error {
+	c.closeOnce.Do(func() {
+		close(c.closed)
+	})
+	return nil
+}
+
+func (c *silentClient) Reconnect() error { return nil }
+
+func TestPoolWorker_RequestTimeout(t *testing.T) {
+	wait := func(t *testing.T, pool *Pool) {
+		done := make(chan struct{})
+		go func() {
+			pool.Wait()
+			close(done)
+		}()
+
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			t.Fatal("wait did not return")
+		}
+	}
+
+	t.Run("unanswered requests are redelivered after the timeout", func(t *testing.T) {
+		client := newSilentClient()
+		defer client.Close()
+
+		var deadLetter error
+		pool := NewPool(PoolOptions{
+			MaxAttempts: 2,
+			DeadLetterHandler: func(height int64, err error) {
+				deadLetter = err
+			},
+		})
+
+		pw := NewMultiplexedPoolWorker(client, 2)
+		pw.SetRequestTimeout(20 * time.Millisecond)
+		pool.AddWorker(pw)
+		pool.Run(func(Response) {})
+		defer pool.Stop()
+
+		pool.Process(1)
+		wait(t, pool)
+
+		require.Equal(t, 2, client.sent())
+		require.Equal(t, ErrResponseTimeout, deadLetter)
+	})
+
+	t.Run("unanswered requests are dead-lettered at their deadline", func(t *testing.T) {
+		client := newSilentClient()
+		defer client.Close()
+
+		var deadLetter error
+		pool := NewPool(PoolOptions{
+			DeadLetterHandler: func(height int64, err error) {
+				deadLetter = err
+			},
+		})
+		pool.AddWorker(NewPoolWorker(client))
+		pool.Run(func(Response) {})
+		defer pool.Stop()
+
+		deadline := time.Now().Add(20 * time.Millisecond)
+		pool.ProcessRequest(Request{Height: 1, Deadline: &deadline})
+		wait(t, pool)
+
+		require.Equal(t, 1, client.sent())
+		require.True(t, errors.Is(deadLetter, ErrDeadlineExceeded))
+	})
+}
+
+// unreachableClient fails to receive responses and to reconnect
+type unreachableClient struct {
+	mu         sync.Mutex
+	reconnects int
+}
+
+func (c *unreachableClient) Send(Request) error      { return nil }
+func (c *unreachableClient) Receive(*Response) error { return errors.New("connection refused") }
+func (c *unreachableClient) Close() error            { return nil }
+func (c *unreachableClient) Reconnect() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.reconnects++
+	return errors.New("connection refused")
+}
+
+// instantClock lets every delay pass right away
+type instantClock struct{}
+
+func (instantClock) After(time.Duration) <-chan time.Time {
+	ch := make(chan time.Time, 1)
+	ch <- time.Time{}
+	return ch
+}
+
+func TestPool_RemoveWorker(t *testing.T) {
+	t.Run("removed worker closes its client", func(t *testing.T) {
+		client := newSilentClient()
+
+		pool := NewPool(PoolOptions{})
+		pw := NewPoolWorker(client)
+		pool.AddWorker(pw)
+		pool.Run(func(Response) {})
+		defer pool.Stop()
+
+		require.Eventually(t, func() bool { return atomic.LoadInt32(&client.receiving) == 1 }, time.Second, time.Millisecond)
+
+		pool.RemoveWorker(pw)
+
+		// The receiving goroutine returns once the client is closed
+		require.Eventually(t, func() bool { return atomic.LoadInt32(&client.receiving) == 0 }, time.Second, time.Millisecond)
+		require.Empty(t, pool.Workers())
+	})
+}
+
+func TestPoolWorker_Backoff(t *testing.T) {
+	t.Run("worker leaves pool when reconnecting runs out of attempts", func(t *testing.T) {
+		client := &unreachableClient{}
+
+		worker := NewPoolWorker(client)
+		worker.SetBackoff(backoff.Options{MaxAttempts: 3, Clock: instantClock{}})
+
+		pool := NewPool(PoolOptions{})
+		pool.AddWorker(worker)
+		pool.Run(func(Response) {})
+		defer pool.Stop()
+
+		require.Eventually(t, func() bool { return len(pool.Workers()) == 0 }, time.Second, 10*time.Millisecond)
+
+		client.mu.Lock()
+		defer client.mu.Unlock()
+		require.Equal(t, 3, client.reconnects)
+	})
+}
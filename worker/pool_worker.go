@@ -1,72 +1,457 @@
 package worker
 
 import (
+	"context"
+	"errors"
+	"strconv"
 	"sync"
 	"time"
+
+	"github.com/figment-networks/indexing-engine/backoff"
+	"github.com/figment-networks/indexing-engine/metrics"
+)
+
+var (
+	// ErrWorkerStopped is returned for requests which were in flight when the pool worker was stopped
+	ErrWorkerStopped = errors.New("pool worker stopped")
+
+	// ErrResponseTimeout is returned for requests not answered within the request timeout of the pool worker
+	ErrResponseTimeout = errors.New("response timeout")
 )
 
-// PoolWorker represents a worker in a pool
+// CompletionHandler handles the result of an attempt to process a request
+type CompletionHandler func(req Request, err error)
+
+// PoolWorker represents a worker in a pool.
+// It can keep multiple requests in flight over one connection, responses are matched to requests by a correlation ID.
 type PoolWorker struct {
-	client  Client
-	backoff Backoff
-	channel chan int64
+	name        string
+	client      Client
+	backoff     *Backoff
+	channel     chan Request
+	maxInFlight int
+	// requestTimeout is the maximum time to wait for a response, there's no limit when it's 0
+	requestTimeout time.Duration
+
+	// registration is set for workers which registered with the manager, they leave the pool when disconnected
+	registration *Registration
+
+	stopOnce sync.Once
+	quit     chan struct{}
+
+	// connMu serializes sending with reconnecting, connCond signals that the connection was reestablished
+	connMu   sync.Mutex
+	connCond *sync.Cond
+	broken   bool
+	// reconnecting is set while the client reestablishes the connection, the client is closed afterwards if the worker was stopped
+	reconnecting bool
+
+	mu sync.Mutex
+	// lastID is used to give requests in flight correlation IDs, pending holds them by their correlation ID
+	lastID  uint64
+	pending map[string]chan result
+
+	// connected, lastHeight and lastErr describe the state of the worker, they're guarded by mu
+	connected  bool
+	lastHeight int64
+	lastErr    error
+}
+
+// result represents the outcome of a request in flight
+type result struct {
+	res Response
+	err error
 }
 
-// NewPoolWorker creates a pool worker
+// NewPoolWorker creates a pool worker processing one request at a time
 func NewPoolWorker(client Client) *PoolWorker {
-	return &PoolWorker{
-		client:  client,
-		channel: make(chan int64),
+	return NewMultiplexedPoolWorker(client, 1)
+}
+
+// NewMultiplexedPoolWorker creates a pool worker keeping up to maxInFlight requests in flight over one connection
+func NewMultiplexedPoolWorker(client Client, maxInFlight int) *PoolWorker {
+	if maxInFlight < 1 {
+		maxInFlight = 1
+	}
+
+	pw := &PoolWorker{
+		client:      client,
+		backoff:     backoff.New(backoff.Options{Jitter: backoff.EqualJitter}),
+		channel:     make(chan Request),
+		maxInFlight: maxInFlight,
+		quit:        make(chan struct{}),
+		pending:     make(map[string]chan result),
+		connected:   true,
+	}
+	pw.connCond = sync.NewCond(&pw.connMu)
+
+	return pw
+}
+
+// Run starts the pool worker.
+// The response handler is called with every received response, the completion handler with the result of every attempt.
+func (pw *PoolWorker) Run(handler ResponseHandler, complete CompletionHandler) {
+	go pw.receive()
+
+	var wg sync.WaitGroup
+	wg.Add(pw.maxInFlight)
+
+	for i := 0; i < pw.maxInFlight; i++ {
+		go func() {
+			defer wg.Done()
+
+			for {
+				select {
+				case req := <-pw.channel:
+					err := pw.process(req, handler)
+					pw.record(req, err)
+
+					if complete != nil {
+						complete(req, err)
+					}
+				case <-pw.quit:
+					return
+				}
+			}
+		}()
+	}
+
+	wg.Wait()
+}
+
+// process handles the processing of a given request.
+// The request is sent with a correlation ID unique for the worker, since IDs set by callers may repeat.
+// The response is passed to the handler with the ID of the request.
+func (pw *PoolWorker) process(req Request, handler ResponseHandler) error {
+	ch := make(chan result, 1)
+
+	pw.mu.Lock()
+	pw.lastID++
+	id := strconv.FormatUint(pw.lastID, 10)
+	pw.pending[id] = ch
+	pw.mu.Unlock()
+
+	heightsDispatchedMetric.WithLabels(pw.name).Inc()
+	inFlightMetric.WithLabels(pw.name).Inc()
+
+	defer func() {
+		pw.mu.Lock()
+		delete(pw.pending, id)
+		pw.mu.Unlock()
+
+		inFlightMetric.WithLabels(pw.name).Dec()
+	}()
+
+	timer := metrics.NewTimer(requestDurationMetric.WithLabels(pw.name))
+
+	sent := req
+	sent.ID = id
+	if err := pw.send(sent); err != nil {
+		return err
+	}
+
+	var expired <-chan time.Time
+	timeout, timeoutErr := pw.timeout(req)
+	if timeoutErr != nil {
+		t := time.NewTimer(timeout)
+		defer t.Stop()
+		expired = t.C
 	}
+
+	var r result
+	select {
+	case r = <-ch:
+	case <-expired:
+		return timeoutErr
+	case <-pw.quit:
+		return ErrWorkerStopped
+	}
+
+	timer.ObserveDuration()
+
+	if r.err != nil {
+		return r.err
+	}
+
+	r.res.ID = req.ID
+	handler(r.res)
+
+	if !r.res.Success {
+		if r.res.Code != "" {
+			return WithErrorCode(r.res.Code, errors.New(r.res.Error))
+		}
+		return errors.New(r.res.Error)
+	}
+
+	return nil
 }
 
-// Run starts the pool worker
-func (pw *PoolWorker) Run(handler ResponseHandler, wg *sync.WaitGroup) {
-	for height := range pw.channel {
-		pw.process(height, handler)
+// timeout returns the time to wait for the response to the request and the error returned when it's not received in time.
+// The error is nil when there's no limit.
+func (pw *PoolWorker) timeout(req Request) (time.Duration, error) {
+	var timeout time.Duration
+	var err error
 
-		if wg != nil {
-			wg.Done()
+	if pw.requestTimeout > 0 {
+		timeout, err = pw.requestTimeout, ErrResponseTimeout
+	}
+
+	if req.Deadline != nil {
+		if untilDeadline := time.Until(*req.Deadline); err == nil || untilDeadline < timeout {
+			timeout, err = untilDeadline, WithErrorCode(ErrorCodeDeadlineExceeded, ErrDeadlineExceeded)
 		}
 	}
+
+	return timeout, err
 }
 
-// process handles the processing of a given height
-func (pw *PoolWorker) process(height int64, handler ResponseHandler) {
-	err := pw.client.Send(Request{Height: height})
+// record updates the state and metrics of the worker with the result of an attempt to process the request
+func (pw *PoolWorker) record(req Request, err error) {
+	pw.mu.Lock()
+	pw.lastHeight = req.Height
+	pw.lastErr = err
+	pw.mu.Unlock()
+
 	if err != nil {
-		pw.reconnect()
-		return
+		heightsFailedMetric.WithLabels(pw.name).Inc()
+	} else {
+		heightsSucceededMetric.WithLabels(pw.name).Inc()
 	}
+}
+
+// setConnected records if the connection with the worker is established
+func (pw *PoolWorker) setConnected(connected bool) {
+	pw.mu.Lock()
+	pw.connected = connected
+	pw.mu.Unlock()
+}
 
-	var res Response
+// receive reads responses and passes them to the requests in flight.
+// When the connection fails, all requests in flight fail and the connection is reestablished.
+// Registered workers are stopped instead, since only they can reestablish the connection.
+// Other workers are stopped when the backoff runs out of attempts.
+func (pw *PoolWorker) receive() {
+	for {
+		var res Response
+
+		err := pw.client.Receive(&res)
+
+		select {
+		case <-pw.quit:
+			return
+		default:
+		}
 
-	err = pw.client.Receive(&res)
+		if err != nil {
+			pw.connMu.Lock()
+			pw.broken = true
+			pw.connMu.Unlock()
+			pw.setConnected(false)
+
+			if pw.registration != nil {
+				pw.Stop()
+				pw.failPending(ErrWorkerStopped)
+				return
+			}
+
+			pw.failPending(err)
+
+			if err := pw.reconnect(); errors.Is(err, backoff.ErrMaxAttempts) {
+				pw.Stop()
+				return
+			}
+			continue
+		}
+
+		pw.deliver(res)
+	}
+}
+
+// send sends the request once the connection is not broken.
+// When sending fails, the connection is closed, so the receiver notices the failure and reestablishes it.
+func (pw *PoolWorker) send(req Request) error {
+	pw.connMu.Lock()
+	defer pw.connMu.Unlock()
+
+	for pw.broken {
+		select {
+		case <-pw.quit:
+			return ErrWorkerStopped
+		default:
+		}
+		pw.connCond.Wait()
+	}
+
+	// The sequence number is internal to the pool
+	req.seq = 0
+
+	err := pw.client.Send(req)
 	if err != nil {
-		pw.reconnect()
-		return
+		pw.broken = true
+		pw.setConnected(false)
+		pw.client.Close()
 	}
 
-	handler(res)
+	return err
 }
 
-// reconnect reestablishes the connection with a worker
+// deliver passes the response to the matching request in flight.
+// Responses without an ID, e.g. from workers using the original protocol, match the only request in flight.
+func (pw *PoolWorker) deliver(res Response) {
+	pw.mu.Lock()
+	defer pw.mu.Unlock()
+
+	id := res.ID
+	if id == "" && len(pw.pending) == 1 {
+		for pendingID := range pw.pending {
+			id = pendingID
+		}
+	}
+
+	if ch, ok := pw.pending[id]; ok {
+		ch <- result{res: res}
+		delete(pw.pending, id)
+	}
+}
+
+// failPending fails all requests in flight with the error
+func (pw *PoolWorker) failPending(err error) {
+	pw.mu.Lock()
+	defer pw.mu.Unlock()
+
+	for id, ch := range pw.pending {
+		ch <- result{err: err}
+		delete(pw.pending, id)
+	}
+}
+
+// reconnect reestablishes the connection with a worker after the backoff delay.
+// Requests are not sent until the connection is reestablished, since the connection is marked as broken.
+// The lock is not held while waiting and dialing, so the worker can be stopped in the meantime.
 func (pw *PoolWorker) reconnect() error {
-	time.Sleep(pw.backoff.Delay())
+	if pw.backoff.Exhausted() {
+		return backoff.ErrMaxAttempts
+	}
+
+	delay := pw.backoff.Delay()
+	backoffDelayMetric.WithLabels(pw.name).Set(delay.Seconds())
+
+	// Stopping the worker interrupts the delay
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-pw.quit:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	if err := pw.backoff.Sleep(ctx, delay); err != nil {
+		return ErrWorkerStopped
+	}
 
 	pw.backoff.Attempt()
+	reconnectsMetric.WithLabels(pw.name).Inc()
+
+	pw.connMu.Lock()
+	pw.reconnecting = true
+	pw.connMu.Unlock()
 
 	err := pw.client.Reconnect()
+
+	pw.connMu.Lock()
+	defer pw.connMu.Unlock()
+
+	pw.reconnecting = false
+
+	select {
+	case <-pw.quit:
+		pw.client.Close()
+		return ErrWorkerStopped
+	default:
+	}
+
 	if err != nil {
 		return err
 	}
 
 	pw.backoff.Reset()
+	backoffDelayMetric.WithLabels(pw.name).Set(0)
+
+	pw.broken = false
+	pw.setConnected(true)
+	pw.connCond.Broadcast()
 
 	return nil
 }
 
-// Stop stops the pool worker
+// Name returns the name of the worker used in metrics and status.
+// Workers which registered with the manager are named after their ID, the pool names other workers by the order they joined.
+func (pw *PoolWorker) Name() string {
+	return pw.name
+}
+
+// SetBackoff sets the options of the backoff used to reestablish the connection.
+// The worker leaves the pool when it can't reconnect in options.MaxAttempts attempts.
+// It must be called before the worker is started.
+func (pw *PoolWorker) SetBackoff(options backoff.Options) {
+	pw.backoff = backoff.New(options)
+}
+
+// SetRequestTimeout sets the maximum time to wait for a response.
+// Requests not answered in time fail with ErrResponseTimeout, so they're redelivered.
+// It must be called before the worker is started.
+func (pw *PoolWorker) SetRequestTimeout(timeout time.Duration) {
+	pw.requestTimeout = timeout
+}
+
+// SetName sets the name of the worker. It must be called before the worker is added to the pool.
+func (pw *PoolWorker) SetName(name string) {
+	pw.name = name
+}
+
+// State returns the current state of the worker
+func (pw *PoolWorker) State() WorkerState {
+	pw.mu.Lock()
+	defer pw.mu.Unlock()
+
+	state := WorkerState{
+		Name:       pw.name,
+		Connected:  pw.connected,
+		Busy:       len(pw.pending) > 0,
+		InFlight:   len(pw.pending),
+		Capacity:   pw.maxInFlight,
+		LastHeight: pw.lastHeight,
+	}
+	if pw.lastErr != nil {
+		state.LastError = pw.lastErr.Error()
+	}
+
+	return state
+}
+
+// Registration returns the registration of a worker which registered with the manager, or nil
+func (pw *PoolWorker) Registration() *Registration {
+	return pw.registration
+}
+
+// Done returns a channel closed when the pool worker is stopped
+func (pw *PoolWorker) Done() <-chan struct{} {
+	return pw.quit
+}
+
+// Stop stops the pool worker and closes its client
 func (pw *PoolWorker) Stop() {
-	close(pw.channel)
+	pw.stopOnce.Do(func() {
+		close(pw.quit)
+
+		pw.connMu.Lock()
+		// A connection being reestablished is closed once it's established
+		if !pw.reconnecting {
+			pw.client.Close()
+		}
+		pw.connCond.Broadcast()
+		pw.connMu.Unlock()
+	})
 }
@@ -0,0 +1,230 @@
+package worker
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+)
+
+const (
+	// MaxRegistrationSize is the maximum size of a registration
+	MaxRegistrationSize = 64 << 10
+
+	// RegistrationTimeout is the maximum time to exchange a registration and its answer
+	RegistrationTimeout = 10 * time.Second
+
+	// registrationMethod takes the place of the request method when signing a registration
+	registrationMethod = "REGISTER"
+)
+
+var (
+	// ErrRegistrationRejected is returned to a worker when the manager does not accept its registration
+	ErrRegistrationRejected = errors.New("registration rejected")
+
+	// ErrNotReconnectable is returned when reconnecting to a worker which registered with the manager.
+	// Only the worker can reestablish the connection, by registering again.
+	ErrNotReconnectable = errors.New("connection can only be reestablished by the worker")
+)
+
+// Registration describes a worker registering itself with the manager
+type Registration struct {
+	// ID identifies the worker
+	ID string `json:"id"`
+
+	// Chains lists the chains the worker can index
+	Chains []string `json:"chains,omitempty"`
+
+	// MaxConcurrency is the number of requests the worker processes at once
+	MaxConcurrency int `json:"max_concurrency"`
+
+	// Auth carries the credentials of the worker, it's set by RegisterWithOptions
+	Auth http.Header `json:"auth,omitempty"`
+}
+
+// RegistrationOptions contains the credentials a worker registers with
+type RegistrationOptions struct {
+	// Token is sent with the registration, see PoolOptions.RegistrationAuth
+	Token string
+
+	// HMACSecret is used to sign the registration, see PoolOptions.RegistrationAuth
+	HMACSecret []byte
+}
+
+// registrationAck is the manager's answer to a registration
+type registrationAck struct {
+	Accepted bool   `json:"accepted"`
+	Error    string `json:"error,omitempty"`
+}
+
+// Register dials the manager and registers the worker with it.
+// The returned server receives requests from the manager once the registration is accepted.
+func Register(network, address string, reg Registration) (*StreamServer, error) {
+	return RegisterWithOptions(network, address, reg, RegistrationOptions{})
+}
+
+// RegisterWithOptions dials the manager and registers the worker with it using the credentials in options.
+// The returned server receives requests from the manager once the registration is accepted.
+func RegisterWithOptions(network, address string, reg Registration, options RegistrationOptions) (*StreamServer, error) {
+	reg.Auth = http.Header{}
+	if err := signHandshake(reg.Auth, registrationMethod, reg.ID, options.Token, options.HMACSecret, time.Now()); err != nil {
+		return nil, err
+	}
+
+	conn, err := net.DialTimeout(network, address, DialTimeout)
+	if err != nil {
+		return nil, err
+	}
+
+	ss := NewStreamServer(conn)
+
+	if err := conn.SetDeadline(time.Now().Add(RegistrationTimeout)); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	if err := writeFrame(conn, reg); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	var ack registrationAck
+	if err := readFrame(ss.reader, &ack); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	if !ack.Accepted {
+		conn.Close()
+		return nil, fmt.Errorf("%w: %s", ErrRegistrationRejected, ack.Error)
+	}
+
+	if err := conn.SetDeadline(time.Time{}); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return ss, nil
+}
+
+// ServeRegistrations accepts workers registering on the listener and adds them to the pool.
+// Registered workers leave the pool when their connection is closed.
+// It blocks until the listener is closed.
+func (p *Pool) ServeRegistrations(ln net.Listener) error {
+	p.init()
+
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			select {
+			case <-p.quit:
+				return nil
+			default:
+				return err
+			}
+		}
+
+		go p.register(conn)
+	}
+}
+
+// register reads the registration from the connection and adds the worker to the pool if it's accepted
+func (p *Pool) register(conn net.Conn) {
+	if err := conn.SetDeadline(time.Now().Add(RegistrationTimeout)); err != nil {
+		conn.Close()
+		return
+	}
+
+	reader := bufio.NewReader(conn)
+
+	var reg Registration
+	if err := readFrameLimit(reader, &reg, MaxRegistrationSize); err != nil {
+		conn.Close()
+		return
+	}
+
+	err := p.acceptWorker(reg)
+	if err == nil {
+		err = p.reserveID(reg.ID)
+	}
+	if err != nil {
+		writeFrame(conn, registrationAck{Error: err.Error()})
+		conn.Close()
+		return
+	}
+	defer p.releaseID(reg.ID)
+
+	if err := writeFrame(conn, registrationAck{Accepted: true}); err != nil {
+		conn.Close()
+		return
+	}
+
+	if err := conn.SetDeadline(time.Time{}); err != nil {
+		conn.Close()
+		return
+	}
+
+	client := &StreamClient{conn: conn, reader: reader}
+
+	worker := NewMultiplexedPoolWorker(client, reg.MaxConcurrency)
+	worker.registration = &reg
+	worker.name = reg.ID
+
+	// A pool stopped in the meantime stops the worker right away, closing the connection
+	p.AddWorker(worker)
+}
+
+func (p *Pool) acceptWorker(reg Registration) error {
+	select {
+	case <-p.quit:
+		return ErrPoolStopped
+	default:
+	}
+
+	if err := p.options.RegistrationAuth.verify(reg.Auth, registrationMethod, reg.ID); err != nil {
+		return err
+	}
+	if reg.ID == "" {
+		return errors.New("missing worker ID")
+	}
+	if reg.MaxConcurrency < 0 {
+		return errors.New("max concurrency must not be negative")
+	}
+
+	if p.options.AcceptWorker != nil {
+		return p.options.AcceptWorker(reg)
+	}
+	return nil
+}
+
+// reserveID reserves the ID of a registering worker until it joins the pool.
+// It fails when the ID belongs to another registering worker or a worker in the pool which hasn't stopped.
+func (p *Pool) reserveID(id string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	taken := p.registering[id]
+	for _, worker := range p.workers {
+		select {
+		case <-worker.Done():
+		default:
+			taken = taken || worker.name == id
+		}
+	}
+	if taken {
+		return fmt.Errorf("worker %s is already registered", id)
+	}
+
+	p.registering[id] = true
+	return nil
+}
+
+// releaseID releases the ID reserved for a registering worker
+func (p *Pool) releaseID(id string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	delete(p.registering, id)
+}
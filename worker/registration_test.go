@@ -0,0 +1,184 @@
+package worker
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPool_ServeRegistrations(t *testing.T) {
+	listen := func(t *testing.T, pool *Pool) net.Listener {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+
+		go pool.ServeRegistrations(ln)
+
+		return ln
+	}
+
+	t.Run("rejected registration", func(t *testing.T) {
+		pool := NewPool(PoolOptions{
+			AcceptWorker: func(reg Registration) error {
+				for _, chain := range reg.Chains {
+					if chain == "cosmos" {
+						return nil
+					}
+				}
+				return errors.New("unsupported chains")
+			},
+		})
+		defer pool.Stop()
+
+		ln := listen(t, pool)
+		defer ln.Close()
+
+		_, err := Register("tcp", ln.Addr().String(), Registration{ID: "worker-1", Chains: []string{"near"}})
+		require.True(t, errors.Is(err, ErrRegistrationRejected))
+
+		_, err = Register("tcp", ln.Addr().String(), Registration{Chains: []string{"cosmos"}})
+		require.True(t, errors.Is(err, ErrRegistrationRejected), "missing ID")
+
+		server, err := Register("tcp", ln.Addr().String(), Registration{ID: "worker-1", Chains: []string{"cosmos"}})
+		require.NoError(t, err)
+		defer server.Close()
+
+		require.Eventually(t, func() bool { return len(pool.Workers()) == 1 }, time.Second, 10*time.Millisecond)
+		require.Equal(t, "worker-1", pool.Workers()[0].Registration().ID)
+	})
+
+	t.Run("pending heights move to workers joining after a worker leaves", func(t *testing.T) {
+		pool := NewPool(PoolOptions{MaxAttempts: 1})
+		defer pool.Stop()
+
+		var mu sync.Mutex
+		var processed []int64
+		pool.Run(func(res Response) {
+			mu.Lock()
+			defer mu.Unlock()
+			processed = append(processed, res.Height)
+		})
+
+		ln := listen(t, pool)
+		defer ln.Close()
+
+		// Heights are held until the first worker joins
+		for height := int64(1); height <= 3; height++ {
+			go pool.Process(height)
+		}
+
+		leaving, err := Register("tcp", ln.Addr().String(), Registration{ID: "leaving", MaxConcurrency: 3})
+		require.NoError(t, err)
+
+		// The leaving worker receives heights, but disconnects without answering
+		var req Request
+		require.NoError(t, leaving.Receive(&req))
+		require.NoError(t, leaving.Close())
+
+		require.Eventually(t, func() bool { return len(pool.Workers()) == 0 }, time.Second, 10*time.Millisecond)
+
+		joining, err := Register("tcp", ln.Addr().String(), Registration{ID: "joining", MaxConcurrency: 2})
+		require.NoError(t, err)
+
+		// The loop returns when the pool is stopped and closes the connection
+		go NewLoop(joining).Run(context.Background(), successHandler)
+
+		require.Eventually(t, func() bool {
+			mu.Lock()
+			defer mu.Unlock()
+			return len(processed) == 3
+		}, 5*time.Second, 10*time.Millisecond)
+
+		mu.Lock()
+		defer mu.Unlock()
+		require.ElementsMatch(t, []int64{1, 2, 3}, processed)
+	})
+	t.Run("unauthenticated registration", func(t *testing.T) {
+		pool := NewPool(PoolOptions{RegistrationAuth: WebsocketAuth{HMACSecret: []byte("secret")}})
+		defer pool.Stop()
+
+		ln := listen(t, pool)
+		defer ln.Close()
+
+		_, err := Register("tcp", ln.Addr().String(), Registration{ID: "worker-1"})
+		require.True(t, errors.Is(err, ErrRegistrationRejected))
+
+		_, err = RegisterWithOptions("tcp", ln.Addr().String(), Registration{ID: "worker-1"}, RegistrationOptions{HMACSecret: []byte("wrong")})
+		require.True(t, errors.Is(err, ErrRegistrationRejected))
+
+		server, err := RegisterWithOptions("tcp", ln.Addr().String(), Registration{ID: "worker-1"}, RegistrationOptions{HMACSecret: []byte("secret")})
+		require.NoError(t, err)
+		defer server.Close()
+
+		require.Eventually(t, func() bool { return len(pool.Workers()) == 1 }, time.Second, 10*time.Millisecond)
+	})
+
+	t.Run("oversized registration", func(t *testing.T) {
+		pool := NewPool(PoolOptions{})
+		defer pool.Stop()
+
+		ln := listen(t, pool)
+		defer ln.Close()
+
+		conn, err := net.Dial("tcp", ln.Addr().String())
+		require.NoError(t, err)
+		defer conn.Close()
+
+		var header [4]byte
+		binary.BigEndian.PutUint32(header[:], MaxRegistrationSize+1)
+		_, err = conn.Write(header[:])
+		require.NoError(t, err)
+
+		// The manager closes the connection without waiting for the registration
+		_, err = conn.Read(make([]byte, 1))
+		require.Equal(t, io.EOF, err)
+		require.Empty(t, pool.Workers())
+	})
+
+	t.Run("duplicate worker ID", func(t *testing.T) {
+		pool := NewPool(PoolOptions{})
+		pool.Run(func(Response) {})
+		defer pool.Stop()
+
+		ln := listen(t, pool)
+		defer ln.Close()
+
+		first, err := Register("tcp", ln.Addr().String(), Registration{ID: "worker-1"})
+		require.NoError(t, err)
+
+		require.Eventually(t, func() bool { return len(pool.Workers()) == 1 }, time.Second, 10*time.Millisecond)
+
+		_, err = Register("tcp", ln.Addr().String(), Registration{ID: "worker-1"})
+		require.True(t, errors.Is(err, ErrRegistrationRejected))
+		require.Len(t, pool.Workers(), 1)
+
+		// The ID can be registered again once the first worker disconnects
+		require.NoError(t, first.Close())
+		require.Eventually(t, func() bool { return len(pool.Workers()) == 0 }, time.Second, 10*time.Millisecond)
+
+		second, err := Register("tcp", ln.Addr().String(), Registration{ID: "worker-1"})
+		require.NoError(t, err)
+		defer second.Close()
+
+		require.Eventually(t, func() bool { return len(pool.Workers()) == 1 }, time.Second, 10*time.Millisecond)
+	})
+
+	t.Run("registration after the pool stopped", func(t *testing.T) {
+		pool := NewPool(PoolOptions{})
+
+		ln := listen(t, pool)
+		defer ln.Close()
+
+		pool.Stop()
+
+		_, err := Register("tcp", ln.Addr().String(), Registration{ID: "worker-1"})
+		require.True(t, errors.Is(err, ErrRegistrationRejected))
+		require.Empty(t, pool.Workers())
+	})
+}
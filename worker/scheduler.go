@@ -0,0 +1,103 @@
+package worker
+
+// WorkerLoad describes the load of a pool worker when scheduling a request
+type WorkerLoad struct {
+	Worker *PoolWorker
+
+	// InFlight is the number of requests dispatched to the worker and not completed yet
+	InFlight int
+
+	// Capacity is the maximum number of requests the worker keeps in flight
+	Capacity int
+}
+
+// Available checks if the worker can take another request
+func (l WorkerLoad) Available() bool {
+	return l.InFlight < l.Capacity
+}
+
+// Scheduler decides which pool worker processes a request
+type Scheduler interface {
+	// Schedule returns the index of an available worker which should process the request.
+	// It returns -1 to keep the request queued until the load of the workers changes.
+	Schedule(req Request, workers []WorkerLoad) int
+}
+
+// LeastInFlightScheduler sends requests to the available worker with the fewest requests in flight.
+// It's used when PoolOptions.Scheduler is not set.
+type LeastInFlightScheduler struct{}
+
+// Schedule returns the index of the available worker with the fewest requests in flight
+func (LeastInFlightScheduler) Schedule(_ Request, workers []WorkerLoad) int {
+	chosen := -1
+	for i, w := range workers {
+		if w.Available() && (chosen < 0 || w.InFlight < workers[chosen].InFlight) {
+			chosen = i
+		}
+	}
+	return chosen
+}
+
+// WeightedScheduler sends requests to the available worker with the lowest load relative to its capacity,
+// so workers with more capacity get proportionally more requests.
+type WeightedScheduler struct{}
+
+// Schedule returns the index of the available worker with the lowest ratio of requests in flight to capacity
+func (WeightedScheduler) Schedule(_ Request, workers []WorkerLoad) int {
+	chosen := -1
+	for i, w := range workers {
+		if !w.Available() {
+			continue
+		}
+		if chosen < 0 {
+			chosen = i
+			continue
+		}
+
+		// Compare InFlight/Capacity ratios without dividing, ties go to the worker with more capacity
+		c := workers[chosen]
+		lhs, rhs := w.InFlight*c.Capacity, c.InFlight*w.Capacity
+		if lhs < rhs || (lhs == rhs && w.Capacity > c.Capacity) {
+			chosen = i
+		}
+	}
+	return chosen
+}
+
+// StickyScheduler sends heights from the same range to the same worker, so it can reuse cached data.
+// Ranges are assigned to workers in the order they joined the pool.
+// When the worker owning the range is busy, the request goes to the fallback scheduler.
+type StickyScheduler struct {
+	// RangeSize is the number of consecutive heights sent to the same worker
+	RangeSize int64
+
+	// Fallback schedules requests whose worker is busy, LeastInFlightScheduler is used when it's nil.
+	// Requests wait for their worker when Fallback returns -1.
+	Fallback Scheduler
+}
+
+// Schedule returns the index of the worker owning the range of the height, or of the worker chosen by the fallback scheduler
+func (s StickyScheduler) Schedule(req Request, workers []WorkerLoad) int {
+	if len(workers) == 0 {
+		return -1
+	}
+
+	rangeSize := s.RangeSize
+	if rangeSize < 1 {
+		rangeSize = 1
+	}
+
+	rangeIndex := req.Height / rangeSize
+	if rangeIndex < 0 {
+		rangeIndex = -rangeIndex
+	}
+
+	if owner := int(rangeIndex % int64(len(workers))); workers[owner].Available() {
+		return owner
+	}
+
+	if s.Fallback != nil {
+		return s.Fallback.Schedule(req, workers)
+	}
+	return LeastInFlightScheduler{}.Schedule(req, workers)
+}
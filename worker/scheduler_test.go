@@ -0,0 +1,148 @@
+package worker
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestScheduler_Schedule(t *testing.T) {
+	loads := func(loads ...[2]int) []WorkerLoad {
+		workers := make([]WorkerLoad, len(loads))
+		for i, l := range loads {
+			workers[i] = WorkerLoad{InFlight: l[0], Capacity: l[1]}
+		}
+		return workers
+	}
+
+	tests := []struct {
+		description string
+		scheduler   Scheduler
+		height      int64
+		workers     []WorkerLoad
+		expected    int
+	}{
+		{"least in flight picks idlest worker", LeastInFlightScheduler{}, 1, loads([2]int{2, 4}, [2]int{1, 4}, [2]int{3, 4}), 1},
+		{"least in flight skips full workers", LeastInFlightScheduler{}, 1, loads([2]int{1, 1}, [2]int{3, 4}), 1},
+		{"least in flight waits when all workers are full", LeastInFlightScheduler{}, 1, loads([2]int{1, 1}, [2]int{4, 4}), -1},
+		{"weighted picks lowest load ratio", WeightedScheduler{}, 1, loads([2]int{1, 2}, [2]int{3, 8}), 1},
+		{"weighted prefers larger capacity on ties", WeightedScheduler{}, 1, loads([2]int{1, 2}, [2]int{4, 8}), 1},
+		{"weighted waits when all workers are full", WeightedScheduler{}, 1, loads([2]int{2, 2}), -1},
+		{"sticky picks range owner", StickyScheduler{RangeSize: 10}, 15, loads([2]int{0, 2}, [2]int{1, 2}, [2]int{0, 2}), 1},
+		{"sticky falls back when owner is busy", StickyScheduler{RangeSize: 10}, 15, loads([2]int{1, 2}, [2]int{2, 2}, [2]int{0, 2}), 2},
+		{"sticky waits without workers", StickyScheduler{RangeSize: 10}, 15, nil, -1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.description, func(t *testing.T) {
+			require.Equal(t, tt.expected, tt.scheduler.Schedule(Request{Height: tt.height}, tt.workers))
+		})
+	}
+}
+
+func TestPool_Scheduler(t *testing.T) {
+	t.Run("sticky scheduler keeps height ranges on one worker", func(t *testing.T) {
+		var mu sync.Mutex
+		processedBy := make(map[int64]int)
+
+		pool := NewPool(PoolOptions{Scheduler: StickyScheduler{
+			RangeSize: 2,
+			Fallback:  schedulerFunc(func(Request, []WorkerLoad) int { return -1 }),
+		}})
+		for i := 0; i < 2; i++ {
+			worker := i
+			pool.AddWorker(NewPoolWorker(newFakeClient(func(req Request) (Response, error) {
+				mu.Lock()
+				defer mu.Unlock()
+				processedBy[req.Height] = worker
+				return Response{Height: req.Height, Success: true}, nil
+			})))
+		}
+		pool.Run(func(Response) {})
+		defer pool.Stop()
+
+		for height := int64(0); height < 8; height++ {
+			pool.Process(height)
+		}
+		pool.Wait()
+
+		require.Equal(t, map[int64]int{0: 0, 1: 0, 2: 1, 3: 1, 4: 0, 5: 0, 6: 1, 7: 1}, processedBy)
+	})
+}
+
+func TestPool_Submit(t *testing.T) {
+	t.Run("submit fails when the queue is full", func(t *testing.T) {
+		pool := NewPool(PoolOptions{QueueSize: 2})
+
+		require.NoError(t, pool.Submit(1))
+		require.NoError(t, pool.Submit(2))
+		require.Equal(t, ErrQueueFull, pool.Submit(3))
+
+		pool.AddWorker(NewPoolWorker(newFakeClient(func(req Request) (Response, error) {
+			return Response{Height: req.Height, Success: true}, nil
+		})))
+		pool.Run(func(Response) {})
+
+		pool.Wait()
+		require.NoError(t, pool.Submit(3))
+		pool.Wait()
+
+		pool.Stop()
+		require.Equal(t, ErrPoolStopped, pool.Submit(4))
+	})
+
+	t.Run("process after stop dead-letters the height", func(t *testing.T) {
+		var deadLetters []int64
+		pool := NewPool(PoolOptions{
+			DeadLetterHandler: func(height int64, err error) {
+				require.Equal(t, ErrPoolStopped, err)
+				deadLetters = append(deadLetters, height)
+			},
+		})
+		pool.Stop()
+
+		pool.Process(1)
+		pool.ProcessRequest(Request{Height: 2})
+		pool.Wait()
+
+		require.Equal(t, []int64{1, 2}, deadLetters)
+	})
+
+	t.Run("process blocks until there's room in the queue", func(t *testing.T) {
+		pool := NewPool(PoolOptions{QueueSize: 1})
+		defer pool.Stop()
+
+		pool.Process(1)
+
+		queued := make(chan struct{})
+		go func() {
+			pool.Process(2)
+			close(queued)
+		}()
+
+		select {
+		case <-queued:
+			t.Fatal("process did not block on a full queue")
+		case <-time.After(100 * time.Millisecond):
+		}
+
+		pool.AddWorker(NewPoolWorker(newFakeClient(func(req Request) (Response, error) {
+			return Response{Height: req.Height, Success: true}, nil
+		})))
+		pool.Run(func(Response) {})
+
+		select {
+		case <-queued:
+		case <-time.After(time.Second):
+			t.Fatal("process did not return once the queue had room")
+		}
+		pool.Wait()
+	})
+}
+
+// schedulerFunc adapts a function to the Scheduler interface
+type schedulerFunc func(Request, []WorkerLoad) int
+
+func (f schedulerFunc) Schedule(req Request, workers []WorkerLoad) int { return f(req, workers) }
@@ -0,0 +1,36 @@
+package worker
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// WorkerState describes the state of a pool worker
+type WorkerState struct {
+	Name string `json:"name"`
+
+	// Connected is false while the connection with the worker is being reestablished
+	Connected bool `json:"connected"`
+
+	// Busy is true when the worker has requests in flight
+	Busy     bool `json:"busy"`
+	InFlight int  `json:"in_flight"`
+	Capacity int  `json:"capacity"`
+
+	// LastHeight is the height of the last completed request, LastError is the error it failed with
+	LastHeight int64  `json:"last_height"`
+	LastError  string `json:"last_error,omitempty"`
+}
+
+// NewStatusHandler creates an http handler returning the state of each worker in the pool as JSON
+func NewStatusHandler(p *Pool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(p.States())
+	})
+}
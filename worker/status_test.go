@@ -0,0 +1,46 @@
+package worker
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestStatusHandler(t *testing.T) {
+	t.Run("returns state of pool workers", func(t *testing.T) {
+		pool := NewPool(PoolOptions{MaxAttempts: 1})
+		pool.AddWorker(NewPoolWorker(newFakeClient(func(req Request) (Response, error) {
+			return Response{Height: req.Height, Error: "bad height"}, nil
+		})))
+
+		named := NewMultiplexedPoolWorker(newFakeClient(func(req Request) (Response, error) {
+			return Response{Height: req.Height, Success: true}, nil
+		}), 4)
+		named.SetName("archive")
+		pool.AddWorker(named)
+
+		pool.Run(func(Response) {})
+		defer pool.Stop()
+
+		pool.ProcessRequest(Request{Height: 5})
+		pool.Wait()
+
+		rec := httptest.NewRecorder()
+		NewStatusHandler(pool).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+		require.Equal(t, http.StatusOK, rec.Code)
+
+		var states []WorkerState
+		require.NoError(t, json.NewDecoder(rec.Body).Decode(&states))
+		require.Equal(t, []WorkerState{
+			{Name: "worker-1", Connected: true, Capacity: 1, LastHeight: 5, LastError: "bad height"},
+			{Name: "archive", Connected: true, Capacity: 4},
+		}, states)
+
+		rec = httptest.NewRecorder()
+		NewStatusHandler(pool).ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/", nil))
+		require.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+	})
+}
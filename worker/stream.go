@@ -0,0 +1,171 @@
+package worker
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"time"
+)
+
+const (
+	// MaxFrameSize is the maximum size of a single message sent over a stream connection
+	MaxFrameSize = 16 << 20
+
+	// DialTimeout is the maximum time to establish a connection with a worker
+	DialTimeout = 10 * time.Second
+)
+
+// ErrFrameTooLarge is returned when a message exceeds MaxFrameSize
+var ErrFrameTooLarge = errors.New("frame too large")
+
+// StreamClient interacts with a worker over a stream connection, like TCP or a Unix domain socket.
+// Messages are sent as JSON prefixed with their length.
+type StreamClient struct {
+	network string
+	address string
+	conn    net.Conn
+	reader  *bufio.Reader
+}
+
+var _ Client = (*StreamClient)(nil)
+
+// NewTCPClient creates a client connected to a worker listening on the TCP address
+func NewTCPClient(address string) (*StreamClient, error) {
+	return newStreamClient("tcp", address)
+}
+
+// NewUnixClient creates a client connected to a worker listening on the Unix domain socket
+func NewUnixClient(path string) (*StreamClient, error) {
+	return newStreamClient("unix", path)
+}
+
+func newStreamClient(network, address string) (*StreamClient, error) {
+	sc := StreamClient{network: network, address: address}
+
+	if err := sc.Connect(); err != nil {
+		return nil, err
+	}
+
+	return &sc, nil
+}
+
+// Connect establishes a stream connection
+func (sc *StreamClient) Connect() error {
+	conn, err := net.DialTimeout(sc.network, sc.address, DialTimeout)
+	if err != nil {
+		return err
+	}
+
+	sc.conn = conn
+	sc.reader = bufio.NewReader(conn)
+
+	return nil
+}
+
+// Send sends a request to a worker
+func (sc *StreamClient) Send(req Request) error {
+	return writeFrame(sc.conn, req)
+}
+
+// Receive receives a response from a worker
+func (sc *StreamClient) Receive(res *Response) error {
+	return readFrame(sc.reader, res)
+}
+
+// Close closes the stream connection
+func (sc *StreamClient) Close() error {
+	return sc.conn.Close()
+}
+
+// Reconnect reestablishes a stream connection.
+// Connections accepted from registering workers can't be reestablished by the manager.
+func (sc *StreamClient) Reconnect() error {
+	if sc.network == "" {
+		return ErrNotReconnectable
+	}
+
+	sc.Close()
+	return sc.Connect()
+}
+
+// StreamServer interacts with a manager over a stream connection
+type StreamServer struct {
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+var _ Server = (*StreamServer)(nil)
+
+// NewStreamServer creates a stream server for a connection accepted from a manager
+func NewStreamServer(conn net.Conn) *StreamServer {
+	return &StreamServer{
+		conn:   conn,
+		reader: bufio.NewReader(conn),
+	}
+}
+
+// Receive receives a request from a manager
+func (ss *StreamServer) Receive(req *Request) error {
+	return readFrame(ss.reader, req)
+}
+
+// Send sends a response back to a manager
+func (ss *StreamServer) Send(res Response) error {
+	return writeFrame(ss.conn, res)
+}
+
+// Close closes the stream connection
+func (ss *StreamServer) Close() error {
+	return ss.conn.Close()
+}
+
+// writeFrame writes the message as JSON prefixed with its length
+func writeFrame(w io.Writer, msg interface{}) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	if len(data) > MaxFrameSize {
+		return ErrFrameTooLarge
+	}
+
+	frame := make([]byte, 4+len(data))
+	binary.BigEndian.PutUint32(frame, uint32(len(data)))
+	copy(frame[4:], data)
+
+	_, err = w.Write(frame)
+	return err
+}
+
+// readFrame reads a message written by writeFrame.
+// It returns io.EOF when the connection is closed between messages and DecodeError when the message is not valid JSON.
+func readFrame(r io.Reader, msg interface{}) error {
+	return readFrameLimit(r, msg, MaxFrameSize)
+}
+
+// readFrameLimit reads a message written by writeFrame, rejecting messages larger than limit
+func readFrameLimit(r io.Reader, msg interface{}, limit uint32) error {
+	var header [4]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return err
+	}
+
+	size := binary.BigEndian.Uint32(header[:])
+	if size > limit {
+		return ErrFrameTooLarge
+	}
+
+	data := make([]byte, size)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return err
+	}
+
+	if err := json.Unmarshal(data, msg); err != nil {
+		return decodeError(data, err)
+	}
+	return nil
+}
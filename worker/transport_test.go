@@ -0,0 +1,190 @@
+package worker
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// processHeights processes heights through a pool with a single worker using the client
+func processHeights(t *testing.T, client Client, heights ...int64) []int64 {
+	pool := NewPool(PoolOptions{})
+	pool.AddWorker(NewPoolWorker(client))
+
+	var mu sync.Mutex
+	var processed []int64
+	pool.Run(func(res Response) {
+		mu.Lock()
+		defer mu.Unlock()
+		if res.Success {
+			processed = append(processed, res.Height)
+		}
+	})
+	defer pool.Stop()
+
+	for _, height := range heights {
+		pool.Process(height)
+	}
+	pool.Wait()
+
+	return processed
+}
+
+func successHandler(Request) error { return nil }
+
+// serveStream serves worker loops for connections accepted on the listener.
+// The first dropConns connections are closed right away.
+func serveStream(ln net.Listener, dropConns int) {
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+
+		if dropConns > 0 {
+			dropConns--
+			conn.Close()
+			continue
+		}
+
+		go NewLoop(NewStreamServer(conn)).Run(context.Background(), successHandler)
+	}
+}
+
+func TestStreamTransport(t *testing.T) {
+	t.Run("TCP", func(t *testing.T) {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		defer ln.Close()
+
+		go serveStream(ln, 0)
+
+		client, err := NewTCPClient(ln.Addr().String())
+		require.NoError(t, err)
+		defer client.Close()
+
+		require.ElementsMatch(t, []int64{1, 2, 3}, processHeights(t, client, 1, 2, 3))
+	})
+
+	t.Run("Unix domain socket", func(t *testing.T) {
+		dir, err := ioutil.TempDir("", "worker-")
+		require.NoError(t, err)
+		defer os.RemoveAll(dir)
+
+		ln, err := net.Listen("unix", filepath.Join(dir, "worker.sock"))
+		require.NoError(t, err)
+		defer ln.Close()
+
+		go serveStream(ln, 0)
+
+		client, err := NewUnixClient(filepath.Join(dir, "worker.sock"))
+		require.NoError(t, err)
+		defer client.Close()
+
+		require.ElementsMatch(t, []int64{1, 2, 3}, processHeights(t, client, 1, 2, 3))
+	})
+
+	t.Run("reconnects after connection is closed", func(t *testing.T) {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		defer ln.Close()
+
+		go serveStream(ln, 1)
+
+		client, err := NewTCPClient(ln.Addr().String())
+		require.NoError(t, err)
+		defer client.Close()
+
+		require.ElementsMatch(t, []int64{1}, processHeights(t, client, 1))
+	})
+
+	t.Run("rejects too large frames", func(t *testing.T) {
+		server, client := net.Pipe()
+		defer server.Close()
+		defer client.Close()
+
+		go client.Write([]byte{0xff, 0xff, 0xff, 0xff})
+
+		var req Request
+		require.Equal(t, ErrFrameTooLarge, NewStreamServer(server).Receive(&req))
+	})
+}
+
+func TestChannelTransport(t *testing.T) {
+	t.Run("processes heights and reconnects", func(t *testing.T) {
+		ln := NewChannelListener()
+		defer ln.Close()
+
+		go func() {
+			first := true
+			for {
+				server, err := ln.Accept()
+				if err != nil {
+					return
+				}
+
+				if first {
+					first = false
+					server.Close()
+					continue
+				}
+
+				go NewLoop(server).Run(context.Background(), successHandler)
+			}
+		}()
+
+		client, err := NewChannelClient(ln)
+		require.NoError(t, err)
+		defer client.Close()
+
+		require.ElementsMatch(t, []int64{1, 2}, processHeights(t, client, 1, 2))
+	})
+
+	t.Run("stopping worker does not wait for reconnect", func(t *testing.T) {
+		ln := NewChannelListener()
+		defer ln.Close()
+
+		go func() {
+			// The first connection is closed and no other is accepted, so reconnecting blocks
+			server, err := ln.Accept()
+			if err == nil {
+				server.Close()
+			}
+		}()
+
+		client, err := NewChannelClient(ln)
+		require.NoError(t, err)
+
+		worker := NewPoolWorker(client)
+		go worker.Run(func(Response) {}, nil)
+
+		time.Sleep(50 * time.Millisecond)
+
+		stopped := make(chan struct{})
+		go func() {
+			worker.Stop()
+			close(stopped)
+		}()
+
+		select {
+		case <-stopped:
+		case <-time.After(time.Second):
+			t.Fatal("stop waited for reconnect")
+		}
+	})
+
+	t.Run("dialing closed listener fails", func(t *testing.T) {
+		ln := NewChannelListener()
+		ln.Close()
+
+		_, err := NewChannelClient(ln)
+		require.Equal(t, ErrListenerClosed, err)
+	})
+}
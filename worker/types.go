@@ -1,15 +1,78 @@
 package worker
 
-// Request respresents a manager request
+import (
+	"time"
+
+	"github.com/figment-networks/indexing-engine/pipeline"
+)
+
+// Request respresents a manager request.
+// Only Height is required, other fields are omitted from JSON when not set.
 type Request struct {
+	// ID identifies the request, it's copied into the response
+	ID string `json:",omitempty"`
+
 	Height int64
+
+	// EndHeight is the last height of the range starting with Height, if the request is for a range of heights
+	EndHeight int64 `json:",omitempty"`
+
+	// TaskWhitelist and StagesBlacklist restrict the pipeline run for the request
+	TaskWhitelist   []pipeline.TaskName  `json:",omitempty"`
+	StagesBlacklist []pipeline.StageName `json:",omitempty"`
+
+	// Deadline is the time after which the response is no longer useful to the manager
+	Deadline *time.Time `json:",omitempty"`
+
+	// Metadata holds arbitrary data passed from the manager to the worker
+	Metadata map[string]string `json:",omitempty"`
+
+	// seq identifies the request while it's pending in the pool, it's not sent to workers
+	seq uint64
+}
+
+// Heights returns the first and the last height of the request
+func (r Request) Heights() (int64, int64) {
+	if r.EndHeight > r.Height {
+		return r.Height, r.EndHeight
+	}
+	return r.Height, r.Height
 }
 
-// Response represents a worker response
+// Expired checks if the deadline of the request has passed
+func (r Request) Expired(now time.Time) bool {
+	return r.Deadline != nil && now.After(*r.Deadline)
+}
+
+// PipelineOptions returns pipeline options matching the task whitelist and stages blacklist of the request
+func (r Request) PipelineOptions() *pipeline.Options {
+	return &pipeline.Options{
+		TaskWhitelist:   r.TaskWhitelist,
+		StagesBlacklist: r.StagesBlacklist,
+	}
+}
+
+// Response represents a worker response.
+// Only Height, Success and Error are always present, other fields are omitted from JSON when not set.
 type Response struct {
+	// ID is the ID of the request
+	ID string `json:",omitempty"`
+
 	Height  int64
 	Success bool
 	Error   string
+
+	// Code classifies the error
+	Code ErrorCode `json:",omitempty"`
+
+	// Stats holds timing of the request on the worker side
+	Stats *ResponseStats `json:",omitempty"`
+}
+
+// ResponseStats represents timing of a request on the worker side
+type ResponseStats struct {
+	StartTime time.Time
+	Duration  time.Duration
 }
 
 // Client interacts with a worker
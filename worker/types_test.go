@@ -0,0 +1,60 @@
+package worker
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/figment-networks/indexing-engine/pipeline"
+)
+
+func TestTypes_JSON(t *testing.T) {
+	t.Run("plain messages keep the original shape", func(t *testing.T) {
+		data, err := json.Marshal(Request{Height: 5})
+		require.NoError(t, err)
+		require.JSONEq(t, `{"Height": 5}`, string(data))
+
+		data, err = json.Marshal(Response{Height: 5, Success: false, Error: "err"})
+		require.NoError(t, err)
+		require.JSONEq(t, `{"Height": 5, "Success": false, "Error": "err"}`, string(data))
+	})
+
+	t.Run("original messages are decoded", func(t *testing.T) {
+		var req Request
+		require.NoError(t, json.Unmarshal([]byte(`{"Height": 5}`), &req))
+		require.Equal(t, Request{Height: 5}, req)
+
+		start, end := req.Heights()
+		require.Equal(t, int64(5), start)
+		require.Equal(t, int64(5), end)
+		require.False(t, req.Expired(time.Now()))
+	})
+
+	t.Run("extended request round trips", func(t *testing.T) {
+		deadline := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+		req := Request{
+			ID:              "req-1",
+			Height:          10,
+			EndHeight:       20,
+			TaskWhitelist:   []pipeline.TaskName{"ParserTask"},
+			StagesBlacklist: []pipeline.StageName{pipeline.StagePersistor},
+			Deadline:        &deadline,
+			Metadata:        map[string]string{"chain": "mainnet"},
+		}
+
+		data, err := json.Marshal(req)
+		require.NoError(t, err)
+
+		var decoded Request
+		require.NoError(t, json.Unmarshal(data, &decoded))
+		require.Equal(t, req, decoded)
+
+		require.True(t, decoded.Expired(deadline.Add(time.Second)))
+		require.Equal(t, &pipeline.Options{
+			TaskWhitelist:   []pipeline.TaskName{"ParserTask"},
+			StagesBlacklist: []pipeline.StageName{pipeline.StagePersistor},
+		}, decoded.PipelineOptions())
+	})
+}
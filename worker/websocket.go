@@ -1,27 +1,81 @@
 package worker
 
 import (
+	"crypto/tls"
+	"encoding/json"
+	"net"
+	"net/http"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"golang.org/x/net/websocket"
 )
 
+const (
+	// defaultWebsocketOrigin is the origin sent when WebsocketOptions.Origin is not set
+	defaultWebsocketOrigin = "http://localhost"
+
+	// heartbeatPing and heartbeatPong are sent as binary frames, so they never mix with JSON messages
+	heartbeatPing heartbeat = "ping"
+	heartbeatPong heartbeat = "pong"
+)
+
+// WebsocketOptions holds options for a websocket client
+type WebsocketOptions struct {
+	// TLSConfig is used for wss:// connections. Endpoints without a scheme use wss:// when it's set.
+	TLSConfig *tls.Config
+
+	// Origin is sent in the handshake, http://localhost is used when it's empty
+	Origin string
+
+	// Token is the shared token sent in the handshake, see WebsocketAuth
+	Token string
+
+	// HMACSecret is used to sign the handshake, see WebsocketAuth
+	HMACSecret []byte
+
+	// HeartbeatInterval is the interval of pings sent to the worker. Heartbeats are disabled when it's 0.
+	HeartbeatInterval time.Duration
+
+	// HeartbeatTimeout is the time without a pong after which the connection is closed, so it's reestablished on Reconnect.
+	// Twice the heartbeat interval is used when it's 0.
+	HeartbeatTimeout time.Duration
+}
+
 // WebsocketClient interacts with a worker using a websocket
 type WebsocketClient struct {
-	url  string
-	conn *websocket.Conn
+	url     string
+	options WebsocketOptions
+
+	mu            sync.Mutex
+	conn          *websocket.Conn
+	stopHeartbeat chan struct{}
+
+	// lastPong holds the time of the last pong in Unix nanoseconds
+	lastPong int64
 }
 
 var _ Client = (*WebsocketClient)(nil)
 
 // NewWebsocketClient creates a websocket client
 func NewWebsocketClient(endpoint string) (*WebsocketClient, error) {
+	return NewWebsocketClientWithOptions(endpoint, WebsocketOptions{})
+}
+
+// NewWebsocketClientWithOptions creates a websocket client with TLS, authentication and heartbeats
+func NewWebsocketClientWithOptions(endpoint string, options WebsocketOptions) (*WebsocketClient, error) {
 	url := endpoint
-	if !strings.HasPrefix(url, "ws://") {
-		url = "ws://" + url
+	if !strings.HasPrefix(url, "ws://") && !strings.HasPrefix(url, "wss://") {
+		if options.TLSConfig != nil {
+			url = "wss://" + url
+		} else {
+			url = "ws://" + url
+		}
 	}
 
-	wc := WebsocketClient{url: url}
+	wc := WebsocketClient{url: url, options: options}
 
 	if err := wc.Connect(); err != nil {
 		return nil, err
@@ -32,28 +86,150 @@ func NewWebsocketClient(endpoint string) (*WebsocketClient, error) {
 
 // Connect establishes a websocket connection
 func (wc *WebsocketClient) Connect() error {
-	conn, err := websocket.Dial(wc.url, "", "http://localhost")
+	origin := wc.options.Origin
+	if origin == "" {
+		origin = defaultWebsocketOrigin
+	}
+
+	config, err := websocket.NewConfig(wc.url, origin)
 	if err != nil {
 		return err
 	}
 
+	config.TlsConfig = wc.options.TLSConfig
+	if err := signHandshake(config.Header, http.MethodGet, config.Location.RequestURI(), wc.options.Token, wc.options.HMACSecret, time.Now()); err != nil {
+		return err
+	}
+
+	conn, err := dialWebsocket(config)
+	if err != nil {
+		return err
+	}
+
+	stop := make(chan struct{})
+
+	wc.mu.Lock()
 	wc.conn = conn
+	wc.stopHeartbeat = stop
+	wc.mu.Unlock()
+
+	if wc.options.HeartbeatInterval > 0 {
+		atomic.StoreInt64(&wc.lastPong, time.Now().UnixNano())
+		go wc.heartbeat(conn, stop)
+	}
 
 	return nil
 }
 
+// dialWebsocket opens a websocket connection, failing when it's not established within DialTimeout
+func dialWebsocket(config *websocket.Config) (*websocket.Conn, error) {
+	deadline := time.Now().Add(DialTimeout)
+	dialer := &net.Dialer{Deadline: deadline}
+
+	address := config.Location.Host
+	if config.Location.Port() == "" {
+		if config.Location.Scheme == "wss" {
+			address = net.JoinHostPort(config.Location.Hostname(), "443")
+		} else {
+			address = net.JoinHostPort(config.Location.Hostname(), "80")
+		}
+	}
+
+	var conn net.Conn
+	var err error
+	if config.Location.Scheme == "wss" {
+		conn, err = tls.DialWithDialer(dialer, "tcp", address, config.TlsConfig)
+	} else {
+		conn, err = dialer.Dial("tcp", address)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// The deadline also bounds the handshake, so a worker which accepts the connection but never answers can't block
+	if err := conn.SetDeadline(deadline); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	ws, err := websocket.NewClient(config, conn)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	if err := conn.SetDeadline(time.Time{}); err != nil {
+		ws.Close()
+		return nil, err
+	}
+
+	return ws, nil
+}
+
+// heartbeat pings the worker and closes the connection when pongs stop arriving
+func (wc *WebsocketClient) heartbeat(conn *websocket.Conn, stop chan struct{}) {
+	timeout := wc.options.HeartbeatTimeout
+	if timeout == 0 {
+		timeout = 2 * wc.options.HeartbeatInterval
+	}
+
+	ticker := time.NewTicker(wc.options.HeartbeatInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+
+		lastPong := time.Unix(0, atomic.LoadInt64(&wc.lastPong))
+		if time.Since(lastPong) > timeout {
+			conn.Close()
+			return
+		}
+
+		if err := websocketCodec.Send(conn, heartbeatPing); err != nil {
+			conn.Close()
+			return
+		}
+	}
+}
+
 // Send sends a request to a worker
 func (wc *WebsocketClient) Send(req Request) error {
-	return websocket.JSON.Send(wc.conn, req)
+	return websocketCodec.Send(wc.currentConn(), req)
 }
 
 // Receive receives a response from a worker
 func (wc *WebsocketClient) Receive(res *Response) error {
-	return websocket.JSON.Receive(wc.conn, res)
+	conn := wc.currentConn()
+
+	for {
+		f := websocketFrame{value: res}
+		if err := websocketCodec.Receive(conn, &f); err != nil {
+			return err
+		}
+
+		switch f.heartbeat {
+		case "":
+			return nil
+		case heartbeatPong:
+			atomic.StoreInt64(&wc.lastPong, time.Now().UnixNano())
+		}
+	}
 }
 
 // Close closes the websocket connection
 func (wc *WebsocketClient) Close() error {
+	wc.mu.Lock()
+	defer wc.mu.Unlock()
+
+	if wc.stopHeartbeat != nil {
+		close(wc.stopHeartbeat)
+		wc.stopHeartbeat = nil
+	}
+
 	return wc.conn.Close()
 }
 
@@ -63,6 +239,13 @@ func (wc *WebsocketClient) Reconnect() error {
 	return wc.Connect()
 }
 
+func (wc *WebsocketClient) currentConn() *websocket.Conn {
+	wc.mu.Lock()
+	defer wc.mu.Unlock()
+
+	return wc.conn
+}
+
 // WebsocketServer interacts with a manager using a websocket
 type WebsocketServer struct {
 	conn *websocket.Conn
@@ -75,17 +258,77 @@ func NewWebsocketServer(conn *websocket.Conn) *WebsocketServer {
 	return &WebsocketServer{conn: conn}
 }
 
-// Receive receives a request from a manager
+// NewWebsocketHandler creates an HTTP handler accepting websocket connections authenticated with auth.
+// The serve function is called with a server for every accepted connection.
+func NewWebsocketHandler(auth WebsocketAuth, serve func(*WebsocketServer)) http.Handler {
+	auth.nonces = newNonceCache()
+
+	return websocket.Server{
+		Handshake: auth.Handshake,
+		Handler: func(conn *websocket.Conn) {
+			serve(NewWebsocketServer(conn))
+		},
+	}
+}
+
+// Receive receives a request from a manager. Pings are answered without being returned.
 func (ws *WebsocketServer) Receive(req *Request) error {
-	return websocket.JSON.Receive(ws.conn, req)
+	for {
+		f := websocketFrame{value: req}
+		if err := websocketCodec.Receive(ws.conn, &f); err != nil {
+			return err
+		}
+
+		switch f.heartbeat {
+		case "":
+			return nil
+		case heartbeatPing:
+			if err := websocketCodec.Send(ws.conn, heartbeatPong); err != nil {
+				return err
+			}
+		}
+	}
 }
 
 // Send sens a response back to a manager
 func (ws *WebsocketServer) Send(res Response) error {
-	return websocket.JSON.Send(ws.conn, res)
+	return websocketCodec.Send(ws.conn, res)
 }
 
 // Close closes the websocket connection
 func (ws *WebsocketServer) Close() error {
 	return ws.conn.Close()
 }
+
+// heartbeat represents a ping or pong message
+type heartbeat string
+
+// websocketFrame holds a received frame, which is either a heartbeat or a JSON message decoded into value
+type websocketFrame struct {
+	heartbeat heartbeat
+	value     interface{}
+}
+
+// websocketCodec sends messages as JSON text frames and heartbeats as binary frames
+var websocketCodec = websocket.Codec{
+	Marshal: func(v interface{}) ([]byte, byte, error) {
+		if hb, ok := v.(heartbeat); ok {
+			return []byte(hb), websocket.BinaryFrame, nil
+		}
+
+		data, err := json.Marshal(v)
+		return data, websocket.TextFrame, err
+	},
+	Unmarshal: func(data []byte, payloadType byte, v interface{}) error {
+		f := v.(*websocketFrame)
+		if payloadType == websocket.BinaryFrame {
+			f.heartbeat = heartbeat(data)
+			return nil
+		}
+
+		if err := json.Unmarshal(data, f.value); err != nil {
+			return decodeError(data, err)
+		}
+		return nil
+	},
+}
@@ -0,0 +1,155 @@
+package worker
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/websocket"
+)
+
+const (
+	// DefaultMaxClockSkew is the maximum age of a signed handshake when WebsocketAuth.MaxClockSkew is not set
+	DefaultMaxClockSkew = time.Minute
+
+	headerAuthorization = "Authorization"
+	headerTimestamp     = "X-Worker-Timestamp"
+	headerNonce         = "X-Worker-Nonce"
+	headerSignature     = "X-Worker-Signature"
+
+	nonceSize = 16
+)
+
+// ErrUnauthorized is returned when a websocket handshake is not authenticated
+var ErrUnauthorized = errors.New("unauthorized")
+
+// WebsocketAuth authenticates websocket handshakes of managers.
+// With Token set, the handshake has to carry the same token. With HMACSecret set, it has to carry
+// a timestamp, a random nonce, the request method and path signed with HMAC-SHA256 using the secret.
+// The timestamp can't be older than MaxClockSkew, and handlers created with NewWebsocketHandler reject
+// nonces seen within that time, so a captured handshake can't be replayed.
+// All handshakes are accepted when neither is set.
+type WebsocketAuth struct {
+	Token        string
+	HMACSecret   []byte
+	MaxClockSkew time.Duration
+
+	nonces *nonceCache
+}
+
+// Handshake checks the handshake request, it can be used as websocket.Server.Handshake
+func (a WebsocketAuth) Handshake(_ *websocket.Config, req *http.Request) error {
+	return a.verify(req.Header, req.Method, req.URL.RequestURI())
+}
+
+// verify checks the credentials in the headers of a handshake sent with method to path
+func (a WebsocketAuth) verify(header http.Header, method, path string) error {
+	if a.Token != "" {
+		token := []byte("Bearer " + a.Token)
+		if subtle.ConstantTimeCompare([]byte(header.Get(headerAuthorization)), token) != 1 {
+			return ErrUnauthorized
+		}
+	}
+
+	if len(a.HMACSecret) > 0 {
+		timestamp := header.Get(headerTimestamp)
+
+		sec, err := strconv.ParseInt(timestamp, 10, 64)
+		if err != nil {
+			return ErrUnauthorized
+		}
+
+		maxClockSkew := a.MaxClockSkew
+		if maxClockSkew == 0 {
+			maxClockSkew = DefaultMaxClockSkew
+		}
+
+		if skew := time.Since(time.Unix(sec, 0)); skew > maxClockSkew || skew < -maxClockSkew {
+			return ErrUnauthorized
+		}
+
+		nonce := header.Get(headerNonce)
+		if len(nonce) != 2*nonceSize {
+			return ErrUnauthorized
+		}
+
+		signature, err := hex.DecodeString(header.Get(headerSignature))
+		if err != nil || !hmac.Equal(signature, sign(a.HMACSecret, method, path, timestamp, nonce)) {
+			return ErrUnauthorized
+		}
+
+		if a.nonces != nil && !a.nonces.add(nonce, time.Now().Add(2*maxClockSkew)) {
+			return ErrUnauthorized
+		}
+	}
+
+	return nil
+}
+
+// signHandshake adds the token and the signed timestamp and nonce to the headers of the handshake
+// sent with method to path
+func signHandshake(header http.Header, method, path, token string, secret []byte, now time.Time) error {
+	if token != "" {
+		header.Set(headerAuthorization, "Bearer "+token)
+	}
+
+	if len(secret) > 0 {
+		b := make([]byte, nonceSize)
+		if _, err := rand.Read(b); err != nil {
+			return err
+		}
+
+		timestamp := strconv.FormatInt(now.Unix(), 10)
+		nonce := hex.EncodeToString(b)
+
+		header.Set(headerTimestamp, timestamp)
+		header.Set(headerNonce, nonce)
+		header.Set(headerSignature, hex.EncodeToString(sign(secret, method, path, timestamp, nonce)))
+	}
+
+	return nil
+}
+
+func sign(secret []byte, method, path, timestamp, nonce string) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(strings.Join([]string{method, path, timestamp, nonce}, "\n")))
+	return mac.Sum(nil)
+}
+
+// nonceCache keeps the nonces of accepted handshakes until they expire
+type nonceCache struct {
+	mu     sync.Mutex
+	nonces map[string]time.Time
+}
+
+func newNonceCache() *nonceCache {
+	return &nonceCache{nonces: make(map[string]time.Time)}
+}
+
+// add stores the nonce until expiry, it returns false when the nonce is already stored
+func (c *nonceCache) add(nonce string, expiry time.Time) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	for n, e := range c.nonces {
+		if now.After(e) {
+			delete(c.nonces, n)
+		}
+	}
+
+	if _, ok := c.nonces[nonce]; ok {
+		return false
+	}
+
+	c.nonces[nonce] = expiry
+	return true
+}
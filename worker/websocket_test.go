@@ -0,0 +1,149 @@
+package worker
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// newTLSWorker starts a worker behind a websocket handler on a local TLS server with a self-signed certificate
+func newTLSWorker(auth WebsocketAuth) (*httptest.Server, *tls.Config) {
+	srv := httptest.NewTLSServer(NewWebsocketHandler(auth, func(server *WebsocketServer) {
+		NewLoop(server).Run(context.Background(), successHandler)
+	}))
+
+	roots := x509.NewCertPool()
+	roots.AddCert(srv.Certificate())
+
+	return srv, &tls.Config{RootCAs: roots}
+}
+
+func endpoint(srv *httptest.Server) string {
+	return strings.TrimPrefix(srv.URL, "https://")
+}
+
+func TestWebsocketClient_Auth(t *testing.T) {
+	t.Run("token", func(t *testing.T) {
+		srv, tlsConfig := newTLSWorker(WebsocketAuth{Token: "secret"})
+		defer srv.Close()
+
+		client, err := NewWebsocketClientWithOptions(endpoint(srv), WebsocketOptions{TLSConfig: tlsConfig, Token: "secret"})
+		require.NoError(t, err)
+		defer client.Close()
+
+		require.ElementsMatch(t, []int64{1, 2}, processHeights(t, client, 1, 2))
+
+		_, err = NewWebsocketClientWithOptions(endpoint(srv), WebsocketOptions{TLSConfig: tlsConfig, Token: "wrong"})
+		require.Error(t, err)
+	})
+
+	t.Run("HMAC", func(t *testing.T) {
+		srv, tlsConfig := newTLSWorker(WebsocketAuth{HMACSecret: []byte("secret")})
+		defer srv.Close()
+
+		client, err := NewWebsocketClientWithOptions("wss://"+endpoint(srv), WebsocketOptions{TLSConfig: tlsConfig, HMACSecret: []byte("secret")})
+		require.NoError(t, err)
+		defer client.Close()
+
+		require.ElementsMatch(t, []int64{1}, processHeights(t, client, 1))
+
+		_, err = NewWebsocketClientWithOptions(endpoint(srv), WebsocketOptions{TLSConfig: tlsConfig, HMACSecret: []byte("wrong")})
+		require.Error(t, err)
+
+		_, err = NewWebsocketClientWithOptions(endpoint(srv), WebsocketOptions{TLSConfig: tlsConfig})
+		require.Error(t, err)
+	})
+
+	t.Run("replayed HMAC handshake", func(t *testing.T) {
+		auth := WebsocketAuth{HMACSecret: []byte("secret"), nonces: newNonceCache()}
+
+		req := httptest.NewRequest(http.MethodGet, "/workers", nil)
+		require.NoError(t, signHandshake(req.Header, http.MethodGet, "/workers", "", []byte("secret"), time.Now()))
+
+		require.NoError(t, auth.Handshake(nil, req))
+		require.Equal(t, ErrUnauthorized, auth.Handshake(nil, req))
+	})
+
+	t.Run("HMAC handshake signed for another path", func(t *testing.T) {
+		auth := WebsocketAuth{HMACSecret: []byte("secret"), nonces: newNonceCache()}
+
+		req := httptest.NewRequest(http.MethodGet, "/workers", nil)
+		require.NoError(t, signHandshake(req.Header, http.MethodGet, "/other", "", []byte("secret"), time.Now()))
+
+		require.Equal(t, ErrUnauthorized, auth.Handshake(nil, req))
+	})
+
+	t.Run("untrusted certificate", func(t *testing.T) {
+		srv, _ := newTLSWorker(WebsocketAuth{})
+		defer srv.Close()
+
+		_, err := NewWebsocketClientWithOptions(endpoint(srv), WebsocketOptions{TLSConfig: &tls.Config{}})
+		require.Error(t, err)
+	})
+}
+
+func TestWebsocketClient_Heartbeat(t *testing.T) {
+	t.Run("connection stays open while worker answers pings", func(t *testing.T) {
+		srv, tlsConfig := newTLSWorker(WebsocketAuth{})
+		defer srv.Close()
+
+		client, err := NewWebsocketClientWithOptions(endpoint(srv), WebsocketOptions{
+			TLSConfig:         tlsConfig,
+			HeartbeatInterval: 10 * time.Millisecond,
+			HeartbeatTimeout:  5 * time.Second,
+		})
+		require.NoError(t, err)
+		defer client.Close()
+
+		received := make(chan error)
+		go func() {
+			var res Response
+			received <- client.Receive(&res)
+		}()
+
+		time.Sleep(100 * time.Millisecond)
+		require.NoError(t, client.Send(Request{ID: "1", Height: 1}))
+
+		require.NoError(t, <-received)
+	})
+
+	t.Run("connection is closed when worker stops answering pings", func(t *testing.T) {
+		stuck := make(chan struct{})
+
+		srv := httptest.NewTLSServer(NewWebsocketHandler(WebsocketAuth{}, func(*WebsocketServer) {
+			<-stuck
+		}))
+		defer srv.Close()
+		defer close(stuck)
+
+		roots := x509.NewCertPool()
+		roots.AddCert(srv.Certificate())
+
+		client, err := NewWebsocketClientWithOptions(endpoint(srv), WebsocketOptions{
+			TLSConfig:         &tls.Config{RootCAs: roots},
+			HeartbeatInterval: 10 * time.Millisecond,
+		})
+		require.NoError(t, err)
+		defer client.Close()
+
+		received := make(chan error)
+		go func() {
+			var res Response
+			received <- client.Receive(&res)
+		}()
+
+		select {
+		case err := <-received:
+			require.Error(t, err)
+		case <-time.After(time.Second):
+			t.Fatal("expected connection to be closed")
+		}
+	})
+}